@@ -1,34 +1,214 @@
 package gcpjwt
 
 import (
+	"context"
+	"sync"
 	"time"
 
 	cache "github.com/patrickmn/go-cache"
+	"golang.org/x/sync/singleflight"
 )
 
+// CertificateCache is used to store public certificates used for verifying tokens. Certificates are keyed by the URL
+// (or other source) they are retrieved from. Implementations must be safe for concurrent use.
+type CertificateCache interface {
+	// Get returns the certificates stored for key along with the time they expire, or false if they were not found
+	// or are past the time they are kept until.
+	Get(ctx context.Context, key string) (Certificates, time.Time, bool)
+
+	// Set stores the certificates for key, which expire at the provided time, keeping them until keepUntil. The
+	// certificates are kept past their expiration to be served while they are refreshed, see StaleGracePeriod.
+	Set(ctx context.Context, key string, certs Certificates, expires, keepUntil time.Time)
+}
+
 var (
-	certsCache *cache.Cache
+	// defaultCertificateCache is shared by all configurations that do not provide their own CertificateCache
+	defaultCertificateCache = NewMemoryCertificateCache()
+
+	// certsGroup is used to deduplicate concurrent fetches for the same certificates
+	certsGroup singleflight.Group
+
+	// lastRefresh tracks when certificates were last fetched for a given cache key so refreshes (e.g. for unknown key
+	// ids) are rate limited across all configs using the key, including configs created for every token.
+	lastRefresh   = make(map[string]time.Time)
+	lastRefreshMu sync.Mutex
 )
 
-func init() {
+type memoryCertificateCache struct {
+	certs *cache.Cache
+}
+
+type certificatesEntry struct {
+	certs   Certificates
+	expires time.Time
+}
+
+// NewMemoryCertificateCache returns an in-memory CertificateCache. This is the default cache used when an IAMConfig
+// does not provide one.
+func NewMemoryCertificateCache() CertificateCache {
 	// We will set expiration time of items and evict on every refresh
-	certsCache = cache.New(0, 0)
+	return &memoryCertificateCache{certs: cache.New(0, 0)}
 }
 
-func getCertsFromCache(serviceAccount string) (certificates, bool) {
-	certsObj, found := certsCache.Get(serviceAccount)
+func (m *memoryCertificateCache) Get(_ context.Context, key string) (Certificates, time.Time, bool) {
+	entryObj, found := m.certs.Get(key)
 	if !found {
-		return nil, false
+		return nil, time.Time{}, false
 	}
 
-	certs, ok := certsObj.(certificates)
-	return certs, ok
+	entry, ok := entryObj.(*certificatesEntry)
+	if !ok {
+		return nil, time.Time{}, false
+	}
+	return entry.certs, entry.expires, true
 }
 
-func updateCache(serviceaccount string, certs certificates, expires time.Time) {
-	exp := time.Until(expires)
-	certsCache.Set(serviceaccount, certs, exp)
+func (m *memoryCertificateCache) Set(_ context.Context, key string, certs Certificates, expires, keepUntil time.Time) {
+	exp := time.Until(keepUntil)
+	if exp <= 0 {
+		// A non-positive expiration would never expire with go-cache
+		m.certs.Delete(key)
+		return
+	}
+	m.certs.Set(key, &certificatesEntry{certs, expires}, exp)
 
 	// Let's try and evict expired items
-	certsCache.DeleteExpired()
+	m.certs.DeleteExpired()
+}
+
+// certificatesFetcher retrieves certificates from their source along with the time they expire, if known
+type certificatesFetcher func(ctx context.Context, config *IAMConfig) (Certificates, time.Time, error)
+
+// cachedCertificates will return the certificates for key from the config's cache when enabled, otherwise they are
+// retrieved using fetch and cached until the returned expiration time. If refresh is true, cached certificates will be
+// fetched again if allowed by the config's MinRefreshInterval.
+func cachedCertificates(ctx context.Context, config *IAMConfig, key string, refresh bool, fetch certificatesFetcher) (Certificates, error) {
+	if !config.EnableCache {
+		certs, _, err := sharedFetch(ctx, config, key, fetch)
+		return certs, err
+	}
+
+	certs, expires, ok := config.certificateCache().Get(ctx, key)
+	if ok && (!refresh || !allowRefresh(key, config.minRefreshInterval())) {
+		if config.refreshDue(expires) && allowRefresh(key, config.minRefreshInterval()) {
+			// Serve the cached certificates while we refresh them, the request's context may be done before we are
+			go func() {
+				_, _ = refreshCertificates(context.WithoutCancel(ctx), config, key, fetch)
+			}()
+		}
+		return certs, nil
+	}
+
+	return refreshCertificates(ctx, config, key, fetch)
+}
+
+// refreshCertificates will fetch the certificates for key and store them in the config's cache, keeping them past
+// their expiration for the config's StaleGracePeriod and scheduling a proactive refresh if RefreshAhead is set.
+func refreshCertificates(ctx context.Context, config *IAMConfig, key string, fetch certificatesFetcher) (Certificates, error) {
+	certs, expires, err := sharedFetch(ctx, config, key, fetch)
+	if err != nil {
+		return nil, err
+	}
+
+	recordRefresh(key)
+
+	if !expires.IsZero() {
+		config.certificateCache().Set(ctx, key, certs, expires, expires.Add(config.StaleGracePeriod))
+
+		if config.RefreshAhead > 0 {
+			config.Lock()
+			config.scheduleRefresh(ctx, key, expires.Add(-config.RefreshAhead), expires, fetch)
+			config.Unlock()
+		}
+	}
+
+	return certs, nil
+}
+
+// scheduleRefresh will refresh the certificates for key in the background at the provided time, but no sooner than
+// MinRefreshInterval from now, retrying every MinRefreshInterval on failure until the certificates expire. Nothing is
+// scheduled if the refresh would not happen before the certificates expire. The config must be locked by the caller.
+func (i *IAMConfig) scheduleRefresh(ctx context.Context, key string, at, expires time.Time, fetch certificatesFetcher) {
+	if i.refreshTimer != nil {
+		i.refreshTimer.Stop()
+		i.refreshTimer = nil
+	}
+
+	interval := i.minRefreshInterval()
+	if interval <= 0 {
+		interval = DefaultMinRefreshInterval
+	}
+	if earliest := time.Now().Add(interval); at.Before(earliest) {
+		at = earliest
+	}
+	if !at.Before(expires) {
+		return
+	}
+
+	// The refresh outlives the request that scheduled it
+	ctx = context.WithoutCancel(ctx)
+	i.refreshTimer = time.AfterFunc(time.Until(at), func() {
+		if _, err := refreshCertificates(ctx, i, key, fetch); err == nil {
+			return
+		}
+
+		i.Lock()
+		i.scheduleRefresh(ctx, key, time.Now(), expires, fetch)
+		i.Unlock()
+	})
+}
+
+// allowRefresh will return true if the certificates for key were last fetched at least interval ago, recording the
+// current time as the last refresh if so. A negative interval never allows a refresh.
+func allowRefresh(key string, interval time.Duration) bool {
+	if interval < 0 {
+		return false
+	}
+
+	lastRefreshMu.Lock()
+	defer lastRefreshMu.Unlock()
+
+	if last, ok := lastRefresh[key]; ok && time.Since(last) < interval {
+		return false
+	}
+	lastRefresh[key] = time.Now()
+
+	return true
+}
+
+// recordRefresh will record the certificates for key as fetched now
+func recordRefresh(key string) {
+	lastRefreshMu.Lock()
+	lastRefresh[key] = time.Now()
+	lastRefreshMu.Unlock()
+}
+
+type fetchedCertificates struct {
+	certs   Certificates
+	expires time.Time
+}
+
+// sharedFetch will call fetch, collapsing concurrent calls for the same key into a single in-flight call whose result
+// is shared with all callers. The fetch is not canceled with the context of the caller that started it, each caller
+// stops waiting when its own context is done.
+func sharedFetch(ctx context.Context, config *IAMConfig, key string, fetch certificatesFetcher) (Certificates, time.Time, error) {
+	fetchCtx := context.WithoutCancel(ctx)
+	ch := certsGroup.DoChan(key, func() (interface{}, error) {
+		certs, expires, err := fetch(fetchCtx, config)
+		if err != nil {
+			return nil, err
+		}
+		return &fetchedCertificates{certs, expires}, nil
+	})
+
+	select {
+	case <-ctx.Done():
+		return nil, time.Time{}, ctx.Err()
+	case res := <-ch:
+		if res.Err != nil {
+			return nil, time.Time{}, res.Err
+		}
+		fetched := res.Val.(*fetchedCertificates)
+		return fetched.certs, fetched.expires, nil
+	}
 }
@@ -0,0 +1,424 @@
+package gcpjwt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMemoryCertificateCache(t *testing.T) {
+	ctx := context.Background()
+	certsCache := NewMemoryCertificateCache()
+	expires := time.Now().Add(time.Hour)
+	certsCache.Set(ctx, "valid", Certificates{"kid": nil}, expires, expires)
+	certsCache.Set(ctx, "stale", Certificates{"kid": nil}, time.Now().Add(-time.Hour), expires)
+	certsCache.Set(ctx, "expired", Certificates{"kid": nil}, time.Now().Add(-time.Hour), time.Now().Add(-time.Hour))
+
+	tests := []struct {
+		name        string
+		key         string
+		wantExpires bool
+		want        bool
+	}{
+		{
+			"Valid",
+			"valid",
+			true,
+			true,
+		},
+		{
+			"Stale",
+			"stale",
+			false,
+			true,
+		},
+		{
+			"Expired",
+			"expired",
+			false,
+			false,
+		},
+		{
+			"Missing",
+			"missing",
+			false,
+			false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, gotExpires, got := certsCache.Get(ctx, tt.key)
+			if got != tt.want {
+				t.Errorf("CertificateCache.Get() = %v, want %v", got, tt.want)
+			}
+			if gotExpires.Equal(expires) != tt.wantExpires {
+				t.Errorf("CertificateCache.Get() expires = %v, want %v: %v", gotExpires, expires, tt.wantExpires)
+			}
+		})
+	}
+}
+
+func Test_cachedCertificates(t *testing.T) {
+	ctx := context.Background()
+	fetches := 0
+	fetch := func(ctx context.Context, config *IAMConfig) (Certificates, time.Time, error) {
+		fetches++
+		return Certificates{}, time.Now().Add(time.Hour), nil
+	}
+	fetchErr := func(ctx context.Context, config *IAMConfig) (Certificates, time.Time, error) {
+		fetches++
+		return nil, time.Time{}, errors.New("fetch failed")
+	}
+
+	config := &IAMConfig{
+		EnableCache:        true,
+		CertificateCache:   NewMemoryCertificateCache(),
+		MinRefreshInterval: time.Hour,
+	}
+
+	tests := []struct {
+		name        string
+		config      *IAMConfig
+		refresh     bool
+		fetch       func(ctx context.Context, config *IAMConfig) (Certificates, time.Time, error)
+		wantFetches int
+		wantErr     bool
+	}{
+		{
+			"ColdCache",
+			config,
+			false,
+			fetch,
+			1,
+			false,
+		},
+		{
+			"WarmCache",
+			config,
+			false,
+			fetch,
+			1,
+			false,
+		},
+		{
+			"RefreshRateLimited",
+			config,
+			true,
+			fetch,
+			1,
+			false,
+		},
+		{
+			"CacheDisabled",
+			&IAMConfig{},
+			false,
+			fetch,
+			2,
+			false,
+		},
+		{
+			"FetchError",
+			&IAMConfig{EnableCache: true, CertificateCache: NewMemoryCertificateCache()},
+			false,
+			fetchErr,
+			3,
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := cachedCertificates(ctx, tt.config, "test", tt.refresh, tt.fetch)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("cachedCertificates() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if fetches != tt.wantFetches {
+				t.Errorf("cachedCertificates() fetches = %d, want %d", fetches, tt.wantFetches)
+			}
+		})
+	}
+}
+
+func Test_allowRefresh(t *testing.T) {
+	never, recent, elapsed, disabled := testCacheKey(t), testCacheKey(t), testCacheKey(t), testCacheKey(t)
+	recordRefresh(recent)
+	lastRefreshMu.Lock()
+	lastRefresh[elapsed] = time.Now().Add(-time.Hour)
+	lastRefreshMu.Unlock()
+
+	tests := []struct {
+		name     string
+		key      string
+		interval time.Duration
+		want     bool
+	}{
+		{
+			"NeverRefreshed",
+			never,
+			time.Hour,
+			true,
+		},
+		{
+			"RecentlyRefreshed",
+			recent,
+			time.Hour,
+			false,
+		},
+		{
+			"IntervalElapsed",
+			elapsed,
+			time.Minute,
+			true,
+		},
+		{
+			"Disabled",
+			disabled,
+			-1,
+			false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := allowRefresh(tt.key, tt.interval); got != tt.want {
+				t.Errorf("allowRefresh() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_cachedCertificatesRateLimitPerKey(t *testing.T) {
+	key := testCacheKey(t)
+	ctx := context.Background()
+	certsCache := NewMemoryCertificateCache()
+	fetches := 0
+	fetch := func(ctx context.Context, config *IAMConfig) (Certificates, time.Time, error) {
+		fetches++
+		return Certificates{}, time.Now().Add(time.Hour), nil
+	}
+
+	// Configs created for every token, as AppEngineVerfiyKeyfunc does, must share the rate limit
+	for i := 0; i < 50; i++ {
+		config := &IAMConfig{EnableCache: true, CertificateCache: certsCache}
+		if _, err := cachedCertificates(ctx, config, key, true, fetch); err != nil {
+			t.Fatalf("cachedCertificates() error = %v", err)
+		}
+	}
+	if fetches != 1 {
+		t.Errorf("cachedCertificates() fetches = %d, want 1", fetches)
+	}
+}
+
+func Test_sharedFetch(t *testing.T) {
+	ctx := context.Background()
+	var fetches int32
+	release := make(chan struct{})
+	fetch := func(ctx context.Context, config *IAMConfig) (Certificates, time.Time, error) {
+		atomic.AddInt32(&fetches, 1)
+		<-release
+		return Certificates{}, time.Now().Add(time.Hour), nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, _, err := sharedFetch(ctx, &IAMConfig{}, "shared-test", fetch); err != nil {
+				t.Errorf("sharedFetch() error = %v", err)
+			}
+		}()
+	}
+
+	// Give the goroutines a chance to join the in-flight fetch
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if got := atomic.LoadInt32(&fetches); got != 1 {
+		t.Errorf("sharedFetch() fetches = %d, want 1", got)
+	}
+}
+
+func Test_sharedFetchCanceled(t *testing.T) {
+	release := make(chan struct{})
+	fetch := func(ctx context.Context, config *IAMConfig) (Certificates, time.Time, error) {
+		<-release
+		if err := ctx.Err(); err != nil {
+			return nil, time.Time{}, err
+		}
+		return Certificates{}, time.Now().Add(time.Hour), nil
+	}
+
+	// The caller starting the fetch gives up before it completes
+	ctx, cancel := context.WithCancel(context.Background())
+	canceled := make(chan error, 1)
+	go func() {
+		_, _, err := sharedFetch(ctx, &IAMConfig{}, "shared-canceled-test", fetch)
+		canceled <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	joined := make(chan error, 1)
+	go func() {
+		_, _, err := sharedFetch(context.Background(), &IAMConfig{}, "shared-canceled-test", fetch)
+		joined <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	cancel()
+	if err := <-canceled; !errors.Is(err, context.Canceled) {
+		t.Errorf("sharedFetch() error = %v, want %v", err, context.Canceled)
+	}
+
+	close(release)
+	if err := <-joined; err != nil {
+		t.Errorf("sharedFetch() error = %v for a caller that was not canceled", err)
+	}
+}
+
+func Test_cachedCertificatesStale(t *testing.T) {
+	key := testCacheKey(t)
+	ctx := context.Background()
+	fetched := make(chan struct{}, 10)
+	fetch := func(ctx context.Context, config *IAMConfig) (Certificates, time.Time, error) {
+		fetched <- struct{}{}
+		return Certificates{}, time.Now().Add(10 * time.Millisecond), nil
+	}
+
+	config := &IAMConfig{
+		EnableCache:        true,
+		CertificateCache:   NewMemoryCertificateCache(),
+		MinRefreshInterval: time.Millisecond,
+		StaleGracePeriod:   time.Hour,
+	}
+
+	if _, err := cachedCertificates(ctx, config, key, false, fetch); err != nil {
+		t.Fatalf("cachedCertificates() error = %v", err)
+	}
+	<-fetched
+
+	// Let the certificates expire, they should still be served while refreshed in the background
+	time.Sleep(20 * time.Millisecond)
+	if _, err := cachedCertificates(ctx, config, key, false, func(ctx context.Context, config *IAMConfig) (Certificates, time.Time, error) {
+		<-time.After(time.Second)
+		return fetch(ctx, config)
+	}); err != nil {
+		t.Fatalf("cachedCertificates() error = %v", err)
+	}
+
+	select {
+	case <-fetched:
+	case <-time.After(5 * time.Second):
+		t.Errorf("expected stale certificates to be refreshed in the background")
+	}
+}
+
+func Test_cachedCertificatesRefreshAhead(t *testing.T) {
+	key := testCacheKey(t)
+	ctx := context.Background()
+	fetched := make(chan struct{}, 10)
+	fetch := func(ctx context.Context, config *IAMConfig) (Certificates, time.Time, error) {
+		fetched <- struct{}{}
+		return Certificates{}, time.Now().Add(time.Hour), nil
+	}
+
+	config := &IAMConfig{
+		EnableCache:        true,
+		CertificateCache:   NewMemoryCertificateCache(),
+		MinRefreshInterval: time.Millisecond,
+		RefreshAhead:       time.Hour - 10*time.Millisecond,
+	}
+
+	if _, err := cachedCertificates(ctx, config, key, false, fetch); err != nil {
+		t.Fatalf("cachedCertificates() error = %v", err)
+	}
+	<-fetched
+
+	select {
+	case <-fetched:
+	case <-time.After(5 * time.Second):
+		t.Errorf("expected certificates to be refreshed ahead of their expiration")
+	}
+
+	config.Lock()
+	config.refreshTimer.Stop()
+	config.Unlock()
+}
+
+func Test_cachedCertificatesRefreshAheadClamped(t *testing.T) {
+	key := testCacheKey(t)
+	var fetches int32
+	fetch := func(ctx context.Context, config *IAMConfig) (Certificates, time.Time, error) {
+		atomic.AddInt32(&fetches, 1)
+		return Certificates{}, time.Now().Add(time.Minute), nil
+	}
+
+	// RefreshAhead is longer than the certificates are valid for, this must not refresh in a loop
+	config := &IAMConfig{
+		EnableCache:      true,
+		CertificateCache: NewMemoryCertificateCache(),
+		RefreshAhead:     5 * time.Minute,
+	}
+	defer config.Close()
+
+	if _, err := cachedCertificates(context.Background(), config, key, false, fetch); err != nil {
+		t.Fatalf("cachedCertificates() error = %v", err)
+	}
+	time.Sleep(200 * time.Millisecond)
+
+	if got := atomic.LoadInt32(&fetches); got != 1 {
+		t.Errorf("cachedCertificates() fetches = %d, want 1", got)
+	}
+}
+
+func Test_cachedCertificatesStaleSharedCache(t *testing.T) {
+	key := testCacheKey(t)
+	fetched := make(chan struct{}, 10)
+	fetch := func(ctx context.Context, config *IAMConfig) (Certificates, time.Time, error) {
+		if err := ctx.Err(); err != nil {
+			return nil, time.Time{}, err
+		}
+		fetched <- struct{}{}
+		return Certificates{}, time.Now().Add(time.Hour), nil
+	}
+
+	// The stale certificates were stored by another config (or process) sharing the cache
+	certsCache := NewMemoryCertificateCache()
+	certsCache.Set(context.Background(), key, Certificates{}, time.Now().Add(-time.Second), time.Now().Add(time.Hour))
+
+	// The request is done before the background refresh runs
+	ctx, cancel := context.WithCancel(context.Background())
+	config := &IAMConfig{
+		EnableCache:        true,
+		CertificateCache:   certsCache,
+		MinRefreshInterval: time.Millisecond,
+		StaleGracePeriod:   time.Hour,
+	}
+	if _, err := cachedCertificates(ctx, config, key, false, fetch); err != nil {
+		t.Fatalf("cachedCertificates() error = %v", err)
+	}
+	cancel()
+
+	select {
+	case <-fetched:
+	case <-time.After(5 * time.Second):
+		t.Errorf("expected stale certificates from a shared cache to be refreshed in the background")
+	}
+}
+
+var testCacheKeys int64
+
+// testCacheKey will return a cache key unique to this run of the test, forgetting when it was last refreshed once the
+// test is done
+func testCacheKey(t *testing.T) string {
+	key := fmt.Sprintf("%s-%d", t.Name(), atomic.AddInt64(&testCacheKeys, 1))
+	t.Cleanup(func() {
+		lastRefreshMu.Lock()
+		delete(lastRefresh, key)
+		lastRefreshMu.Unlock()
+	})
+	return key
+}
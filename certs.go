@@ -2,56 +2,82 @@ package gcpjwt
 
 import (
 	"context"
-	"crypto/rsa"
+	"crypto"
 	"encoding/json"
 	"io/ioutil"
 	"net/http"
 	"time"
 
-	"github.com/dgrijalva/jwt-go"
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/pquerna/cachecontrol"
+	"google.golang.org/api/googleapi"
 )
 
 const (
 	certificateURL = "https://www.googleapis.com/robot/v1/metadata/x509/"
+	jwksURL        = "https://www.googleapis.com/robot/v1/metadata/jwk/"
 )
 
-// certificates is a map of key id -> public keys
-type certificates map[string]*rsa.PublicKey
+// Certificates is a map of key id -> public keys
+type Certificates map[string]crypto.PublicKey
 
-func getCertificates(ctx context.Context, config *IAMConfig) (certificates, error) {
-	if config.EnableCache {
-		if certsResp, ok := getCertsFromCache(config.ServiceAccount); ok {
-			return certsResp, nil
-		}
+// getCertificates will return the certificates from the configured key source, using the cache if enabled. If
+// refresh is true, cached certificates will be refetched if allowed by the config's MinRefreshInterval.
+func getCertificates(ctx context.Context, config *IAMConfig, refresh bool) (Certificates, error) {
+	return cachedCertificates(ctx, config, config.keySourceURL(), refresh, fetchCertificates)
+}
+
+// fetchCertificates will retrieve the certificates from the configured key source, a *KeySourceError is returned on
+// failure.
+func fetchCertificates(ctx context.Context, config *IAMConfig) (Certificates, time.Time, error) {
+	certs, expires, err := fetchKeySource(ctx, config)
+	if err != nil {
+		return nil, time.Time{}, &KeySourceError{Source: config.keySourceURL(), Err: err}
 	}
 
+	return certs, expires, nil
+}
+
+func fetchKeySource(ctx context.Context, config *IAMConfig) (Certificates, time.Time, error) {
 	// Default config.Client is a http.DefaultClient
 	client := config.Client
 	if client == nil {
 		client = getDefaultClient(ctx)
 	}
 
-	req, err := http.NewRequest(http.MethodGet, certificateURL+config.ServiceAccount, nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, config.keySourceURL(), nil)
 	if err != nil {
-		return nil, err
+		return nil, time.Time{}, err
 	}
 
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
+	var resp *http.Response
+	var b []byte
+	err = config.RetryPolicy.do(ctx, func() error {
+		resp, err = client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		if err = googleapi.CheckResponse(resp); err != nil {
+			return err
+		}
 
-	b, err := ioutil.ReadAll(resp.Body)
+		b, err = ioutil.ReadAll(resp.Body)
+		return err
+	})
 	if err != nil {
-		return nil, err
+		return nil, time.Time{}, err
 	}
 
-	certsRaw := make(map[string]string)
-	err = json.Unmarshal(b, &certsRaw)
+	var certs Certificates
+	if config.KeySource == JWKSKeySource {
+		certs, err = parseJWKS(b)
+	} else {
+		certs, err = parseX509Certificates(b)
+	}
 	if err != nil {
-		return nil, err
+		return nil, time.Time{}, err
 	}
 
 	_, expires, err := cachecontrol.CachableResponse(req, resp, cachecontrol.Options{PrivateCache: true})
@@ -59,7 +85,18 @@ func getCertificates(ctx context.Context, config *IAMConfig) (certificates, erro
 		expires = time.Now().Add(config.CacheExpiration)
 	}
 
-	certs := make(certificates)
+	return certs, expires, nil
+}
+
+// parseX509Certificates will parse a JSON map of key id -> PEM encoded x509 certificate
+func parseX509Certificates(b []byte) (Certificates, error) {
+	certsRaw := make(map[string]string)
+	err := json.Unmarshal(b, &certsRaw)
+	if err != nil {
+		return nil, err
+	}
+
+	certs := make(Certificates)
 	for key, cert := range certsRaw {
 		rsaKey, err := jwt.ParseRSAPublicKeyFromPEM([]byte(cert))
 		if err != nil {
@@ -68,9 +105,5 @@ func getCertificates(ctx context.Context, config *IAMConfig) (certificates, erro
 		certs[key] = rsaKey
 	}
 
-	if config.EnableCache && !expires.IsZero() {
-		updateCache(config.ServiceAccount, certs, expires)
-	}
-
 	return certs, nil
 }
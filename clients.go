@@ -0,0 +1,99 @@
+package gcpjwt
+
+import (
+	"context"
+
+	kms "cloud.google.com/go/kms/apiv1"
+	"github.com/googleapis/gax-go/v2"
+	iamcredentials "google.golang.org/api/iamcredentials/v1"
+	"google.golang.org/api/option"
+	htransport "google.golang.org/api/transport/http"
+)
+
+// kmsCallOptions are passed to every Cloud KMS call. The client's own retries are disabled as calls are retried
+// according to the KMSConfig's RetryPolicy, which would otherwise multiply the attempts made.
+var kmsCallOptions = []gax.CallOption{gax.WithRetry(nil)}
+
+// kmsClient will return the user provided KMSClient or the client shared by all calls using this config, creating it
+// if needed.
+func kmsClient(ctx context.Context, config *KMSConfig) (*kms.KeyManagementClient, error) {
+	if config.KMSClient != nil {
+		return config.KMSClient, nil
+	}
+
+	config.clientMu.Lock()
+	defer config.clientMu.Unlock()
+
+	if config.client == nil {
+		// The client outlives the call that created it
+		client, err := kms.NewKeyManagementClient(context.WithoutCancel(ctx))
+		if err != nil {
+			return nil, err
+		}
+		config.client = client
+	}
+
+	return config.client, nil
+}
+
+// Close will close the Cloud KMS client created for this config, if any. A user provided KMSClient is not closed. The
+// config may still be used after calling Close, a new client will be created when needed.
+func (k *KMSConfig) Close() error {
+	k.clientMu.Lock()
+	defer k.clientMu.Unlock()
+
+	if k.client == nil {
+		return nil
+	}
+
+	err := k.client.Close()
+	k.client = nil
+	return err
+}
+
+// getIAMService will return the user provided IAMService or the service shared by all calls using this config,
+// creating it if needed.
+func getIAMService(ctx context.Context, config *IAMConfig) (*iamcredentials.Service, error) {
+	if config.IAMService != nil {
+		return config.IAMService, nil
+	}
+
+	config.Lock()
+	defer config.Unlock()
+
+	if config.iamService == nil {
+		// The service outlives the call that created it
+		ctx = context.WithoutCancel(ctx)
+		client, _, err := htransport.NewClient(ctx, option.WithScopes(iamcredentials.CloudPlatformScope))
+		if err != nil {
+			return nil, err
+		}
+		iamService, err := iamcredentials.NewService(ctx, option.WithHTTPClient(client))
+		if err != nil {
+			return nil, err
+		}
+		config.httpClient, config.iamService = client, iamService
+	}
+
+	return config.iamService, nil
+}
+
+// Close will release the iamcredentials service created for this config, if any, and stop any scheduled refresh of
+// cached certificates. A user provided IAMService is not affected. The config may still be used after calling Close, a
+// new service will be created when needed.
+func (i *IAMConfig) Close() error {
+	i.Lock()
+	defer i.Unlock()
+
+	if i.refreshTimer != nil {
+		i.refreshTimer.Stop()
+		i.refreshTimer = nil
+	}
+
+	if i.httpClient != nil {
+		i.httpClient.CloseIdleConnections()
+	}
+	i.httpClient, i.iamService = nil, nil
+
+	return nil
+}
@@ -0,0 +1,81 @@
+package gcpjwt
+
+import (
+	"context"
+	"testing"
+
+	iamcredentials "google.golang.org/api/iamcredentials/v1"
+)
+
+func TestKMSConfig_Close(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	config := &KMSConfig{KeyPath: "invalid"}
+	if err := config.Close(); err != nil {
+		t.Errorf("KMSConfig.Close() without a client error = %v", err)
+	}
+
+	client, err := kmsClient(ctx, config)
+	if err != nil {
+		t.Errorf("could not create client: %v", err)
+		return
+	}
+	// The client must outlive the context it was created with
+	cancel()
+	if shared, _ := kmsClient(context.Background(), config); shared != client {
+		t.Errorf("expected the client to be shared")
+	}
+
+	if err = config.Close(); err != nil {
+		t.Errorf("KMSConfig.Close() error = %v", err)
+	}
+	newClient, err := kmsClient(context.Background(), config)
+	if err != nil {
+		t.Errorf("could not create client: %v", err)
+		return
+	}
+	if newClient == client {
+		t.Errorf("expected a new client after Close")
+	}
+	_ = config.Close()
+
+	userConfig := &KMSConfig{KeyPath: "invalid", KMSClient: client}
+	if got, _ := kmsClient(context.Background(), userConfig); got != client {
+		t.Errorf("expected the user provided client")
+	}
+	if err = userConfig.Close(); err != nil || userConfig.KMSClient != client {
+		t.Errorf("KMSConfig.Close() must not close the user provided client")
+	}
+}
+
+func TestIAMConfig_Close(t *testing.T) {
+	config := &IAMConfig{ServiceAccount: "invalid"}
+	if err := config.Close(); err != nil {
+		t.Errorf("IAMConfig.Close() without a service error = %v", err)
+	}
+
+	iamService, err := getIAMService(context.Background(), config)
+	if err != nil {
+		t.Errorf("could not create service: %v", err)
+		return
+	}
+	if shared, _ := getIAMService(context.Background(), config); shared != iamService {
+		t.Errorf("expected the service to be shared")
+	}
+
+	if err = config.Close(); err != nil {
+		t.Errorf("IAMConfig.Close() error = %v", err)
+	}
+	if newService, _ := getIAMService(context.Background(), config); newService == iamService {
+		t.Errorf("expected a new service after Close")
+	}
+
+	userService := &iamcredentials.Service{}
+	userConfig := &IAMConfig{ServiceAccount: "invalid", IAMService: userService}
+	if got, _ := getIAMService(context.Background(), userConfig); got != userService {
+		t.Errorf("expected the user provided service")
+	}
+	if err = userConfig.Close(); err != nil || userConfig.IAMService != userService {
+		t.Errorf("IAMConfig.Close() must not affect the user provided service")
+	}
+}
@@ -6,10 +6,13 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 
 	kms "cloud.google.com/go/kms/apiv1"
+	kmspb "cloud.google.com/go/kms/apiv1/kmspb"
+	cache "github.com/patrickmn/go-cache"
 	iamcredentials "google.golang.org/api/iamcredentials/v1"
 )
 
@@ -24,11 +27,39 @@ const (
 	IAMJwtType
 )
 
+type keySourceType int
+
+const (
+	// X509KeySource is used to retrieve public keys in the format of a map of key id -> PEM encoded x509 certificate,
+	// as served by https://www.googleapis.com/robot/v1/metadata/x509/<service-account>. This is the default.
+	X509KeySource keySourceType = iota
+	// JWKSKeySource is used to retrieve public keys in the JSON Web Key Set format (RFC 7517), as served by
+	// https://www.googleapis.com/robot/v1/metadata/jwk/<service-account> or any other JWKS publishing issuer.
+	JWKSKeySource
+)
+
+const (
+	// DefaultMinRefreshInterval is the default minimum time between forced refreshes of cached certificates when a
+	// token references an unknown key id.
+	DefaultMinRefreshInterval = time.Minute
+
+	// DefaultKeyVersionRefreshInterval is the default time between rediscovering the enabled versions of a Cloud KMS
+	// CryptoKey.
+	DefaultKeyVersionRefreshInterval = time.Hour
+
+	// DefaultVerifyCacheExpiration is the default time to remember successful Cloud KMS MacVerify results for when
+	// KMSConfig.EnableVerifyCache is true.
+	DefaultVerifyCacheExpiration = 5 * time.Minute
+)
+
 var (
 	// ErrMissingConfig is returned when Sign or Verify did not find a configuration in the provided context
 	ErrMissingConfig = errors.New("gcpjwt: missing configuration in provided context")
 )
 
+// serviceAccountPrefix is the prefix of service account resource names accepted by the iamcredentials API
+const serviceAccountPrefix = "projects/-/serviceAccounts/"
+
 type iamConfigKey struct{}
 type kmsConfigKey struct{}
 
@@ -41,21 +72,63 @@ type IAMConfig struct {
 	// Service account can be the email address or the uniqueId of the service account used to sign the JWT with
 	ServiceAccount string
 
-	// EnableCache will enable the in-memory caching of public certificates.
+	// Delegates is the chain of service accounts, in the format of "projects/-/serviceAccounts/<email or uniqueId>",
+	// to impersonate in order to sign as the ServiceAccount. Each service account in the chain must be granted the
+	// Service Account Token Creator role on the next, and the last on the ServiceAccount.
+	// https://cloud.google.com/iam/docs/create-short-lived-credentials-delegated
+	Delegates []string
+
+	// KeySource is the format of the public keys used to verify tokens, X509KeySource is used by default.
+	KeySource keySourceType
+
+	// KeySourceURL is the URL to retrieve public keys from in the format of the KeySource. Defaults to Google's
+	// metadata endpoint for the ServiceAccount. Use with the JWKSKeySource to verify tokens from any JWKS publishing
+	// issuer.
+	KeySourceURL string
+
+	// EnableCache will enable the caching of public certificates.
 	// The cache will expire certificates when an expiration is known or fallback to the configured CacheExpiration
 	EnableCache bool
 
+	// CertificateCache is a user provided cache to store public certificates in when EnableCache is true, otherwise
+	// an in-memory cache shared by all configurations without a CertificateCache will be used.
+	CertificateCache CertificateCache
+
 	// CacheExpiration is the default time to keep the certificates in cache if no expiration time is provided
 	// Use a value of 0 to disable the expiration time fallback. Max reccomneded value is 24 hours.
 	// https://cloud.google.com/iam/docs/understanding-service-accounts#managing_service_account_keys
 	CacheExpiration time.Duration
 
+	// MinRefreshInterval is the minimum time to wait between refreshing cached certificates when a token references
+	// a key id not found in the cache (e.g. after a key rotation). This limits how often tokens with unknown key ids
+	// can trigger a fetch of the certificates, across all configs retrieving certificates from the same key source.
+	// Defaults to DefaultMinRefreshInterval, use a negative value to never refresh the cache on unknown key ids.
+	// Only used when EnableCache is true.
+	MinRefreshInterval time.Duration
+
+	// StaleGracePeriod will allow expired certificates to be served from the cache for up to this long past their
+	// expiration while they are refreshed in the background, so verifying tokens does not wait on or fail because of
+	// fetching certificates. Background refreshes are attempted at most once every MinRefreshInterval.
+	// Only used when EnableCache is true.
+	StaleGracePeriod time.Duration
+
+	// RefreshAhead will proactively refresh cached certificates in the background this long before they expire, but no
+	// sooner than MinRefreshInterval after they were fetched. Failed refreshes will be retried every MinRefreshInterval
+	// until the certificates expire. Certificates retrieved from the cache within this long of their expiration are
+	// refreshed in the background as well. Only used when EnableCache is true.
+	RefreshAhead time.Duration
+
+	// RetryPolicy configures how calls to the signBlob and signJwt APIs, and to retrieve public certificates, are
+	// retried after transient failures. The defaults are used if nil.
+	RetryPolicy *RetryPolicy
+
 	// IAMType is a helper used to help clarify which IAM signing method this config is meant for.
 	// Used for the jwtmiddleware and oauth2 packages.
 	IAMType iamType
 
 	// IAMService is a user provided service client that should be used when communicating with the iamcredentials API,
-	// otherwuse the default service will be used.
+	// otherwuse the default service will be initiated on first use and shared by all calls using this config until
+	// Close is called.
 	IAMService *iamcredentials.Service
 
 	// OAuth2HTTPClient is a user provided oauth2 authenticated *http.Client to use, google.DefaultClient used otherwise
@@ -67,14 +140,18 @@ type IAMConfig struct {
 	// Used for verify requests
 	Client *http.Client
 
-	lastKeyID string
+	lastKeyID    string
+	refreshTimer *time.Timer
+
+	iamService *iamcredentials.Service
+	httpClient *http.Client
 
 	sync.RWMutex
 }
 
 // KeyID will return the last used KeyID to sign the JWT - though it should be noted the signJwt method will always
 // add its own token header which is not parsed back to the token.
-// Helper function for adding the kid header to your token.
+// Use SignToken to create tokens with the kid header set.
 func (i *IAMConfig) KeyID() string {
 	i.RLock()
 	defer i.RUnlock()
@@ -82,19 +159,121 @@ func (i *IAMConfig) KeyID() string {
 	return i.lastKeyID
 }
 
+// serviceAccountName will return the resource name of the ServiceAccount to sign with, validating the Delegates chain.
+func (i *IAMConfig) serviceAccountName() (string, error) {
+	for _, delegate := range i.Delegates {
+		account := strings.TrimPrefix(delegate, serviceAccountPrefix)
+		if account == delegate || account == "" || strings.Contains(account, "/") {
+			return "", fmt.Errorf("gcpjwt: invalid delegate `%s`, expected format `%s<email or uniqueId>`", delegate, serviceAccountPrefix)
+		}
+	}
+
+	return serviceAccountPrefix + i.ServiceAccount, nil
+}
+
+func (i *IAMConfig) keySourceURL() string {
+	switch {
+	case i.KeySourceURL != "":
+		return i.KeySourceURL
+	case i.KeySource == JWKSKeySource:
+		return jwksURL + i.ServiceAccount
+	default:
+		return certificateURL + i.ServiceAccount
+	}
+}
+
+func (i *IAMConfig) certificateCache() CertificateCache {
+	if i.CertificateCache == nil {
+		return defaultCertificateCache
+	}
+	return i.CertificateCache
+}
+
+func (i *IAMConfig) minRefreshInterval() time.Duration {
+	if i.MinRefreshInterval == 0 {
+		return DefaultMinRefreshInterval
+	}
+	return i.MinRefreshInterval
+}
+
+// refreshDue will return true if certificates expiring at the provided time should be refreshed in the background: they
+// have expired and are served within a StaleGracePeriod, or expire within RefreshAhead.
+func (i *IAMConfig) refreshDue(expires time.Time) bool {
+	return !expires.IsZero() && time.Now().After(expires.Add(-i.RefreshAhead))
+}
+
 // KMSConfig is used to sign/verify JWTs with Google Cloud KMS
 type KMSConfig struct {
 	// KeyPath is the name of the key to use in the format of:
 	// "name=projects/*/locations/*/keyRings/*/cryptoKeys/*/cryptoKeyVersions/*"
+	// The asymmetric signing methods also accept the name of a CryptoKey in the format of:
+	// "projects/*/locations/*/keyRings/*/cryptoKeys/*"
+	// in which case tokens are signed with the version matching the token's kid header, or the newest enabled version
+	// if the token has no kid. See CurrentKeyID.
 	KeyPath string
 
-	// KMSClient to use for calls to the API. If nil, a standard one will be initiated
+	// KMSClient to use for calls to the API. If nil, a standard one will be initiated on first use and shared by all
+	// calls using this config until Close is called.
 	KMSClient *kms.KeyManagementClient
+
+	// RetryPolicy configures how calls to the Cloud KMS API are retried after transient failures. The defaults are
+	// used if nil. It replaces the retries of the KMSClient's CallOptions, which are disabled for calls made with this
+	// config.
+	RetryPolicy *RetryPolicy
+
+	// KeyVersionRefreshInterval is how often the enabled versions of a CryptoKey are rediscovered when KeyPath names
+	// a CryptoKey rather than a CryptoKeyVersion, for both signing and verifying. Defaults to
+	// DefaultKeyVersionRefreshInterval.
+	KeyVersionRefreshInterval time.Duration
+
+	// EnableVerifyCache will remember tokens successfully verified with the Cloud KMS HMAC signing methods so repeated
+	// verifications of the same token do not call the MacVerify API. Tokens are keyed by a SHA256 hash of the signing
+	// string and signature.
+	EnableVerifyCache bool
+
+	// VerifyCacheExpiration is how long successful verifications are remembered when EnableVerifyCache is true.
+	// Defaults to DefaultVerifyCacheExpiration.
+	VerifyCacheExpiration time.Duration
+
+	verifyCache     *cache.Cache
+	verifyCacheOnce sync.Once
+
+	versions        []*kmspb.CryptoKeyVersion
+	versionsRefresh time.Time
+	algorithms      map[string]kmspb.CryptoKeyVersion_CryptoKeyVersionAlgorithm
+	versionsMu      sync.Mutex
+
+	client   *kms.KeyManagementClient
+	clientMu sync.Mutex
 }
 
 // KeyID will return the SHA1 hash of the configured KeyPath. Helper function for adding the kid header to your token.
+// Use CurrentKeyID when KeyPath names a CryptoKey.
 func (k *KMSConfig) KeyID() string {
-	return fmt.Sprintf("%x", sha1.Sum([]byte(k.KeyPath)))
+	return kmsKeyID(k.KeyPath)
+}
+
+// kmsKeyID will return the key id for the provided Cloud KMS key version name
+func kmsKeyID(name string) string {
+	return fmt.Sprintf("%x", sha1.Sum([]byte(name)))
+}
+
+func (k *KMSConfig) keyVersionRefreshInterval() time.Duration {
+	if k.KeyVersionRefreshInterval <= 0 {
+		return DefaultKeyVersionRefreshInterval
+	}
+	return k.KeyVersionRefreshInterval
+}
+
+func (k *KMSConfig) verifiedTokens() *cache.Cache {
+	k.verifyCacheOnce.Do(func() {
+		expiration := k.VerifyCacheExpiration
+		if expiration <= 0 {
+			expiration = DefaultVerifyCacheExpiration
+		}
+		k.verifyCache = cache.New(expiration, expiration)
+	})
+	return k.verifyCache
 }
 
 // NewIAMContext returns a new context.Context that carries a provided IAMConfig value
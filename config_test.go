@@ -32,3 +32,32 @@ func TestKMSConfig_KeyID(t *testing.T) {
 		})
 	}
 }
+
+func TestIAMConfig_serviceAccountName(t *testing.T) {
+	tests := []struct {
+		name      string
+		delegates []string
+		want      string
+		wantErr   bool
+	}{
+		{"NoDelegates", nil, "projects/-/serviceAccounts/c@p.iam.gserviceaccount.com", false},
+		{"Delegates", []string{"projects/-/serviceAccounts/a@p.iam.gserviceaccount.com", "projects/-/serviceAccounts/123456789"}, "projects/-/serviceAccounts/c@p.iam.gserviceaccount.com", false},
+		{"MissingPrefix", []string{"a@p.iam.gserviceaccount.com"}, "", true},
+		{"ProjectID", []string{"projects/p/serviceAccounts/a@p.iam.gserviceaccount.com"}, "", true},
+		{"Empty", []string{"projects/-/serviceAccounts/"}, "", true},
+		{"TrailingPath", []string{"projects/-/serviceAccounts/a@p.iam.gserviceaccount.com/keys"}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &IAMConfig{ServiceAccount: "c@p.iam.gserviceaccount.com", Delegates: tt.delegates}
+			got, err := config.serviceAccountName()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("IAMConfig.serviceAccountName() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("IAMConfig.serviceAccountName() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
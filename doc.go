@@ -5,7 +5,7 @@ Should work across virtually all environments, on or off of Google's Cloud Platf
 Getting Started
 
 It is highly recommended that you override the default algorithm implementations that you want to leverage a GCP service
-for in dgrijalva/jwt-go. You otherwise will have to manually pick the verification method for your JWTs and they will
+for in golang-jwt/jwt. You otherwise will have to manually pick the verification method for your JWTs and they will
 place non-standard headers in the rendered JWT (with the exception of signJwt from the IAM API which overwrites the
 header with its own).
 
@@ -15,7 +15,7 @@ algorithms such as `gcpjwt.SigningMethodKMSRS256.Override()` and `gcpjwt.Signing
 Example:
 
 	import (
-		"github.com/someone1/gcp-jwt-go"
+		"github.com/someone1/gcp-jwt-go/v3"
 	)
 
 	func init() {
@@ -26,6 +26,13 @@ Example:
 		gcpjwt.SigningMethodKMSPS256.Override() // PS256
 		gcpjwt.SigningMethodKMSES256.Override() // ES256
 		gcpjwt.SigningMethodKMSES384.Override() // ES384
+		gcpjwt.SigningMethodKMSRS512.Override() // RS512
+		gcpjwt.SigningMethodKMSPS512.Override() // PS512
+		gcpjwt.SigningMethodKMSES256K.Override() // ES256K
+		gcpjwt.SigningMethodKMSEdDSA.Override() // EdDSA
+		gcpjwt.SigningMethodKMSHS256.Override() // HS256
+		gcpjwt.SigningMethodKMSHS384.Override() // HS384
+		gcpjwt.SigningMethodKMSHS512.Override() // HS512
 
 		// IAM API - This implements RS256 exclusively
 		gcpjwt.SigningMethodIAMJWT.Override() // For signJwt
@@ -36,11 +43,12 @@ Example:
 		gcpjwt.SigningMethodAppEngine.Override()
 	}
 
-As long as a you override a default algorithm implementation as shown above, using the dgrijalva/jwt-go is mostly unchanged.
+As long as a you override a default algorithm implementation as shown above, using the golang-jwt/jwt package is mostly unchanged.
+The golang-jwt/jwt package does not implement ES256K, gcpjwt.SigningMethodES256K is provided to verify these tokens.
 
 Create a Token
 
-Token creation is more/less done the same way as in the dgrijalva/jwt-go package. The key that you need to provide is
+Token creation is more/less done the same way as in the golang-jwt/jwt package. The key that you need to provide is
 always going to be a context.Context, usuaully with a configuration object loaded in:
 	- use gcpjwt.IAMConfig for the SigningMethodIAMJWT and SigningMethodIAMBlob signing methods
 	- use an appengine.NewContext for the SigningMethodAppEngine signing method
@@ -52,9 +60,10 @@ Example:
 	import (
 		"context"
 		"net/http"
+		"time"
 
-		"github.com/dgrijalva/jwt-go"
-		"github.com/someone1/gcp-jwt-go"
+		"github.com/golang-jwt/jwt/v5"
+		"github.com/someone1/gcp-jwt-go/v3"
 		"google.golang.org/appengine" // only on AppEngine Standard when using the SigningMethodAppEngine signing method
 	)
 
@@ -64,8 +73,8 @@ Example:
 		// make.
 
 		var key interface{}
-		claims := &jwt.StandardClaims{
-			ExpiresAt: 15000,
+		claims := &jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
 			Issuer:    "test",
 		}
 		token := jwt.NewWithClaims(gcpjwt.SigningMethodGCPJWT, claims)
@@ -85,6 +94,17 @@ Example:
 		}
 		key = gcpjwt.NewKMSContext(ctx, config)
 
+		// For any asymmetric KMS signing method, signing with the newest enabled version of a CryptoKey
+		config := &gcpjwt.KMSConfig{
+			KeyPath: "projects/<project-id>/locations/<location>/keyRings/<key-ring-name>/cryptoKeys/<key-name>",
+		}
+		kid, err := config.CurrentKeyID(ctx)
+		if err != nil {
+			return "", err
+		}
+		token.Header["kid"] = kid
+		key = gcpjwt.NewKMSContext(ctx, config)
+
 		// For SigningMethodAppEngine
 		key = ctx
 
@@ -93,23 +113,32 @@ Example:
 
 		// For signJwt
 		// !!IMPORTANT!! Due to the way the signJwt API returns tokens, we can't use the standard signing process
-		// to sign
-		signingString, err := token.SigningString()
+		// to sign. SignJwt returns the token issued by the API, including its header, along with the parsed token
+		signedJwt, _, err := gcpjwt.SignJwt(gcpjwt.NewIAMContext(ctx, config), claims)
 		if err != nil {
 			return "", err
 		}
 
-		return token.Method.Sign(signingString, key)
+		return signedJwt, nil
 	}
 
+Alternatively, gcpjwt.SignToken will create and sign a token with the kid and typ headers set for any of the signing
+methods, including signJwt, so tokens can always be verified by their kid:
+
+	tokenString, err := gcpjwt.SignToken(gcpjwt.NewKMSContext(ctx, config), gcpjwt.SigningMethodKMSES256, claims)
+
 Validate a Token
 
 Finally, the steps to validate a token should be straight forward. This library provides you with helper jwt.Keyfunc
 implementations to do the heavy lifting around getting the public certificates for verification:
 
 	- gcpjwt.IAMVerfiyKeyfunc can be used for the IAM API and the AppEngine Standard signing methods
+	- gcpjwt.IAMVerfiyKeyfunc with an IAMConfig using the gcpjwt.JWKSKeySource can also be used for tokens from any JWKS publishing issuer
 	- gcpjwt.AppEngineVerfiyKeyfunc is only available on AppEngine standard and can only be used on JWT signed from the same default service account as the running application
 	- gcp.KMSVerfiyKeyfunc can be used for the Cloud KMS signing methods
+	- gcpjwt.KMSCryptoKeyVerfiyKeyfunc can be used for the Cloud KMS signing methods with any enabled version of a CryptoKey, allowing keys to be rotated
+	- gcpjwt.KMSHMACVerfiyKeyfunc can be used for the Cloud KMS HMAC signing methods, which verify tokens with the MacVerify API
+	- gcpjwt.Verifier can be used to accept tokens from multiple issuers, picking one of the above based on the token's iss claim
 
 Example:
 
@@ -118,8 +147,8 @@ Example:
 		"time"
 		"strings"
 
-		"github.com/dgrijalva/jwt-go"
-		"github.com/someone1/gcp-jwt-go"
+		"github.com/golang-jwt/jwt/v5"
+		"github.com/someone1/gcp-jwt-go/v3"
 	)
 
 	func validateToken(ctx context.Context, tokenString string) (*jwt.Token, error) {
@@ -156,7 +185,7 @@ Example:
 		// The following is an extreme and advanced use-case - it is NOT recommended but here for those who need it.
 		//
 		// If we need to manually override the detected jwt.SigningMethod based on the 'alg' header
-		// This is basically copying the https://github.com/dgrijalva/jwt-go/blob/master/parser.go#L23 ParseWithClaims function here but forcing our own method vs getting one based on the Alg field
+		// This is basically copying the https://github.com/golang-jwt/jwt/blob/main/parser.go ParseWithClaims function here but forcing our own method vs getting one based on the Alg field
 		// Or Try and parse, Ignore the result and try with the proper method:
 		token, _ := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 			return nil, nil
@@ -0,0 +1,145 @@
+package gcpjwt
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrKeyNotFound is matched by errors.Is for a *KeyNotFoundError
+	ErrKeyNotFound = errors.New("gcpjwt: key not found")
+
+	// ErrKeySourceUnavailable is matched by errors.Is for a *KeySourceError
+	ErrKeySourceUnavailable = errors.New("gcpjwt: key source unavailable")
+
+	// ErrSigningBackend is matched by errors.Is for a *SigningError
+	ErrSigningBackend = errors.New("gcpjwt: signing backend error")
+
+	// ErrIntegrityCheckFailed is matched by errors.Is for an *IntegrityError
+	ErrIntegrityCheckFailed = errors.New("gcpjwt: integrity check failed")
+
+	// ErrUnexpectedSigningMethod is returned by the jwt.Keyfunc helpers when a token's alg header does not match a
+	// signing method the key source can verify
+	ErrUnexpectedSigningMethod = errors.New("gcpjwt: unexpected signing method")
+
+	// ErrUnknownIssuer is returned by Verifier.Keyfunc when a token's issuer is missing or not trusted
+	ErrUnknownIssuer = errors.New("gcpjwt: unknown issuer")
+)
+
+// KeyNotFoundError is returned when no public key (or Cloud KMS key version) matching a token's kid header and signing
+// method could be found for the issuer.
+type KeyNotFoundError struct {
+	// KeyID is the kid the key was looked up for, empty if the token had no kid header
+	KeyID string
+
+	// Issuer is the service account, key source URL, or Cloud KMS key the key was looked up for
+	Issuer string
+}
+
+func (e *KeyNotFoundError) Error() string {
+	if e.KeyID == "" {
+		return fmt.Sprintf("gcpjwt: could not find key(s) for `%s`", e.Issuer)
+	}
+	return fmt.Sprintf("gcpjwt: could not find key id `%s` for `%s`", e.KeyID, e.Issuer)
+}
+
+// Is will report whether target is ErrKeyNotFound
+func (e *KeyNotFoundError) Is(target error) bool {
+	return target == ErrKeyNotFound
+}
+
+// KeySourceError is returned when public keys could not be retrieved from a key source, such as the service account
+// metadata endpoint, a JWKS URL, or the Cloud KMS API.
+type KeySourceError struct {
+	// Source is the URL or Cloud KMS resource name keys were retrieved from, if known
+	Source string
+
+	// Err is the underlying error
+	Err error
+}
+
+func (e *KeySourceError) Error() string {
+	if e.Source == "" {
+		return fmt.Sprintf("gcpjwt: could not get public keys: %v", e.Err)
+	}
+	return fmt.Sprintf("gcpjwt: could not get public keys from `%s`: %v", e.Source, e.Err)
+}
+
+// Is will report whether target is ErrKeySourceUnavailable
+func (e *KeySourceError) Is(target error) bool {
+	return target == ErrKeySourceUnavailable
+}
+
+// Unwrap will return the underlying error
+func (e *KeySourceError) Unwrap() error {
+	return e.Err
+}
+
+// SigningError is returned when a call to a remote signing backend (the signBlob or signJwt APIs, or the Cloud KMS
+// AsymmetricSign, MacSign, or MacVerify APIs) fails. Use errors.As to retrieve the underlying *googleapi.Error, or
+// status.FromError to retrieve the gRPC status.
+type SigningError struct {
+	// Name is the service account or Cloud KMS resource name the call was made for
+	Name string
+
+	// Err is the underlying error
+	Err error
+}
+
+func (e *SigningError) Error() string {
+	return fmt.Sprintf("gcpjwt: signing backend call for `%s` failed: %v", e.Name, e.Err)
+}
+
+// Is will report whether target is ErrSigningBackend
+func (e *SigningError) Is(target error) bool {
+	return target == ErrSigningBackend
+}
+
+// Unwrap will return the underlying error
+func (e *SigningError) Unwrap() error {
+	return e.Err
+}
+
+// IntegrityError is returned when a request to or response from Cloud KMS fails an integrity check, indicating that
+// data was corrupted in transit. The call may be safely retried.
+// https://cloud.google.com/kms/docs/data-integrity-guidelines
+type IntegrityError struct {
+	// Name is the Cloud KMS resource name the request was made for
+	Name string
+
+	// Check is the integrity check that failed, e.g. "signature_crc32c"
+	Check string
+}
+
+func (e *IntegrityError) Error() string {
+	return fmt.Sprintf("gcpjwt: Cloud KMS integrity check `%s` failed for `%s`", e.Check, e.Name)
+}
+
+// Is will report whether target is ErrIntegrityCheckFailed
+func (e *IntegrityError) Is(target error) bool {
+	return target == ErrIntegrityCheckFailed
+}
+
+// RetryError is returned when a call was retried according to a RetryPolicy and did not succeed. It wraps the error of
+// every attempt, in order, so errors.Is and errors.As match any of them.
+type RetryError struct {
+	// Attempts holds the error of each attempt made
+	Attempts []error
+}
+
+func (e *RetryError) Error() string {
+	return fmt.Sprintf("gcpjwt: call failed after %d attempts: %v", len(e.Attempts), e.Last())
+}
+
+// Last will return the error of the last attempt.
+func (e *RetryError) Last() error {
+	if len(e.Attempts) == 0 {
+		return nil
+	}
+	return e.Attempts[len(e.Attempts)-1]
+}
+
+// Unwrap will return the error of every attempt.
+func (e *RetryError) Unwrap() []error {
+	return e.Attempts
+}
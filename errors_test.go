@@ -0,0 +1,50 @@
+package gcpjwt
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"google.golang.org/api/googleapi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestErrors(t *testing.T) {
+	apiErr := &googleapi.Error{Code: http.StatusServiceUnavailable}
+	grpcErr := status.Error(codes.PermissionDenied, "denied")
+	integrityErr := &IntegrityError{Name: "key", Check: "mac_crc32c"}
+
+	tests := []struct {
+		name   string
+		err    error
+		target error
+	}{
+		{"KeyNotFound", &KeyNotFoundError{KeyID: "kid", Issuer: "issuer"}, ErrKeyNotFound},
+		{"KeySource", &KeySourceError{Source: "https://example.com", Err: apiErr}, ErrKeySourceUnavailable},
+		{"KeySourceWrapped", &KeySourceError{Err: apiErr}, apiErr},
+		{"Signing", &SigningError{Name: "key", Err: grpcErr}, ErrSigningBackend},
+		{"SigningRetried", &SigningError{Name: "key", Err: &RetryError{Attempts: []error{integrityErr, apiErr}}}, apiErr},
+		{"Integrity", fmt.Errorf("wrapped: %w", integrityErr), ErrIntegrityCheckFailed},
+		{"SigningIntegrity", &SigningError{Name: "key", Err: &RetryError{Attempts: []error{integrityErr, apiErr}}}, ErrIntegrityCheckFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !errors.Is(tt.err, tt.target) {
+				t.Errorf("errors.Is(%v, %v) = false, want true", tt.err, tt.target)
+			}
+		})
+	}
+
+	var gotAPIErr *googleapi.Error
+	if err := error(&SigningError{Name: "key", Err: apiErr}); !errors.As(err, &gotAPIErr) || gotAPIErr.Code != http.StatusServiceUnavailable {
+		t.Errorf("errors.As(%v) did not find the *googleapi.Error", err)
+	}
+	if s, ok := status.FromError(&SigningError{Name: "key", Err: grpcErr}); !ok || s.Code() != codes.PermissionDenied {
+		t.Errorf("status.FromError() = %v, want %v", s.Code(), codes.PermissionDenied)
+	}
+	if errors.Is(&KeyNotFoundError{}, ErrKeySourceUnavailable) {
+		t.Errorf("errors.Is(*KeyNotFoundError, ErrKeySourceUnavailable) = true, want false")
+	}
+}
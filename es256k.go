@@ -0,0 +1,113 @@
+package gcpjwt
+
+import (
+	"crypto"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	secp256k1ecdsa "github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// SigningMethodSecp256k1 implements the ES256K signing method (ECDSA using secp256k1 and SHA-256) from RFC 8812 as it is
+// not provided by the jwt package. Sign expects a *secp256k1.PrivateKey and Verify expects a *secp256k1.PublicKey.
+type SigningMethodSecp256k1 struct{}
+
+// SigningMethodES256K is the ES256K signing method, it is registered with the jwt package unless another implementation
+// has already been registered for the ES256K algorithm.
+var SigningMethodES256K *SigningMethodSecp256k1
+
+var (
+	oidPublicKeyECDSA      = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+	oidNamedCurveSecp256k1 = asn1.ObjectIdentifier{1, 3, 132, 0, 10}
+)
+
+func init() {
+	SigningMethodES256K = &SigningMethodSecp256k1{}
+	if jwt.GetSigningMethod(SigningMethodES256K.Alg()) == nil {
+		jwt.RegisterSigningMethod(SigningMethodES256K.Alg(), func() jwt.SigningMethod {
+			return SigningMethodES256K
+		})
+	}
+}
+
+// Alg will return the JWT header algorithm identifier for this signing method.
+func (s *SigningMethodSecp256k1) Alg() string {
+	return "ES256K"
+}
+
+// Sign implements the Sign method from jwt.SigningMethod, the signature is returned in the R || S format.
+func (s *SigningMethodSecp256k1) Sign(signingString string, key interface{}) ([]byte, error) {
+	privateKey, ok := key.(*secp256k1.PrivateKey)
+	if !ok {
+		return nil, jwt.ErrInvalidKeyType
+	}
+
+	digest := crypto.SHA256.New()
+	_, _ = digest.Write([]byte(signingString))
+
+	signature := secp256k1ecdsa.Sign(privateKey, digest.Sum(nil))
+	r, sv := signature.R(), signature.S()
+
+	out := make([]byte, 64)
+	r.PutBytesUnchecked(out[:32])
+	sv.PutBytesUnchecked(out[32:])
+	return out, nil
+}
+
+// Verify implements the Verify method from jwt.SigningMethod, the signature is expected in the R || S format.
+func (s *SigningMethodSecp256k1) Verify(signingString string, signature []byte, key interface{}) error {
+	publicKey, ok := key.(*secp256k1.PublicKey)
+	if !ok {
+		return jwt.ErrInvalidKeyType
+	}
+
+	if len(signature) != 64 {
+		return jwt.ErrSignatureInvalid
+	}
+
+	var r, sv secp256k1.ModNScalar
+	if overflow := r.SetByteSlice(signature[:32]); overflow {
+		return jwt.ErrSignatureInvalid
+	}
+	if overflow := sv.SetByteSlice(signature[32:]); overflow {
+		return jwt.ErrSignatureInvalid
+	}
+
+	digest := crypto.SHA256.New()
+	_, _ = digest.Write([]byte(signingString))
+
+	if !secp256k1ecdsa.NewSignature(&r, &sv).Verify(digest.Sum(nil), publicKey) {
+		return jwt.ErrSignatureInvalid
+	}
+
+	return nil
+}
+
+// parseSecp256k1PublicKey will parse a DER encoded PKIX secp256k1 public key, which the x509 package does not support
+func parseSecp256k1PublicKey(der []byte) (*secp256k1.PublicKey, error) {
+	var publicKeyInfo struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if rest, err := asn1.Unmarshal(der, &publicKeyInfo); err != nil {
+		return nil, err
+	} else if len(rest) != 0 {
+		return nil, fmt.Errorf("gcpjwt: trailing data after public key")
+	}
+
+	var namedCurve asn1.ObjectIdentifier
+	if !publicKeyInfo.Algorithm.Algorithm.Equal(oidPublicKeyECDSA) {
+		return nil, fmt.Errorf("gcpjwt: public key is not an ECDSA key")
+	}
+	if _, err := asn1.Unmarshal(publicKeyInfo.Algorithm.Parameters.FullBytes, &namedCurve); err != nil {
+		return nil, err
+	}
+	if !namedCurve.Equal(oidNamedCurveSecp256k1) {
+		return nil, fmt.Errorf("gcpjwt: public key is not a secp256k1 key")
+	}
+
+	return secp256k1.ParsePubKey(publicKeyInfo.PublicKey.RightAlign())
+}
@@ -0,0 +1,110 @@
+package gcpjwt
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"testing"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestSigningMethodSecp256k1_SignAndVerify(t *testing.T) {
+	privateKey, err := secp256k1.GeneratePrivateKey()
+	if err != nil {
+		t.Errorf("could not generate key: %v", err)
+		return
+	}
+	otherKey, err := secp256k1.GeneratePrivateKey()
+	if err != nil {
+		t.Errorf("could not generate key: %v", err)
+		return
+	}
+
+	signingString := "eyJ0eXAiOiJKV1QiLCJhbGciOiJFUzI1NksifQ.eyJmb28iOiJiYXIifQ"
+	signature, err := SigningMethodES256K.Sign(signingString, privateKey)
+	if err != nil {
+		t.Errorf("SigningMethodES256K.Sign() error = %v", err)
+		return
+	}
+	if len(signature) != 64 {
+		t.Errorf("expected signature length of 64, got %d", len(signature))
+	}
+
+	tests := []struct {
+		name          string
+		signingString string
+		key           interface{}
+		wantErr       bool
+	}{
+		{
+			"Valid",
+			signingString,
+			privateKey.PubKey(),
+			false,
+		},
+		{
+			"WrongKey",
+			signingString,
+			otherKey.PubKey(),
+			true,
+		},
+		{
+			"WrongSigningString",
+			signingString + "a",
+			privateKey.PubKey(),
+			true,
+		},
+		{
+			"InvalidKeyType",
+			signingString,
+			privateKey,
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := SigningMethodES256K.Verify(tt.signingString, signature, tt.key); (err != nil) != tt.wantErr {
+				t.Errorf("SigningMethodES256K.Verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if method := jwt.GetSigningMethod("ES256K"); method == nil {
+		t.Errorf("expected ES256K to be registered")
+	}
+}
+
+func Test_parseSecp256k1PublicKey(t *testing.T) {
+	privateKey, err := secp256k1.GeneratePrivateKey()
+	if err != nil {
+		t.Errorf("could not generate key: %v", err)
+		return
+	}
+
+	marshal := func(curve asn1.ObjectIdentifier) []byte {
+		params, _ := asn1.Marshal(curve)
+		point := privateKey.PubKey().SerializeUncompressed()
+		der, _ := asn1.Marshal(struct {
+			Algorithm pkix.AlgorithmIdentifier
+			PublicKey asn1.BitString
+		}{
+			pkix.AlgorithmIdentifier{Algorithm: oidPublicKeyECDSA, Parameters: asn1.RawValue{FullBytes: params}},
+			asn1.BitString{Bytes: point, BitLength: len(point) * 8},
+		})
+		return der
+	}
+
+	publicKey, err := parseSecp256k1PublicKey(marshal(oidNamedCurveSecp256k1))
+	if err != nil {
+		t.Errorf("parseSecp256k1PublicKey() error = %v", err)
+		return
+	}
+	if !publicKey.IsEqual(privateKey.PubKey()) {
+		t.Errorf("parsed public key does not match")
+	}
+
+	if _, err = parseSecp256k1PublicKey(marshal(asn1.ObjectIdentifier{1, 2, 840, 10045, 3, 1, 7})); err == nil {
+		t.Errorf("expected error for P-256 curve")
+	}
+}
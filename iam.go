@@ -2,10 +2,14 @@ package gcpjwt
 
 import (
 	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/rsa"
 	"fmt"
 
-	"github.com/dgrijalva/jwt-go"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/golang-jwt/jwt/v5"
 	"google.golang.org/api/iamcredentials/v1"
 )
 
@@ -14,7 +18,7 @@ import (
 type SigningMethodIAM struct {
 	alg      string
 	override string
-	sign     func(ctx context.Context, iamService *iamcredentials.Service, config *IAMConfig, signingString string) (string, error)
+	sign     func(ctx context.Context, iamService *iamcredentials.Service, config *IAMConfig, signingString string) ([]byte, string, error)
 }
 
 // Alg will return the JWT header algorithm identifier this method is configured for.
@@ -32,8 +36,9 @@ func (s *SigningMethodIAM) Override() {
 
 // Sign implements the Sign method from jwt.SigningMethod. For this signing method, a valid context.Context must be
 // passed as the key containing a IAMConfig value.
-// NOTE: The HEADER IS IGNORED for the signJWT API as the API will add its own
-func (s *SigningMethodIAM) Sign(signingString string, key interface{}) (string, error) {
+// NOTE: The HEADER IS IGNORED for the signJWT API as the API will add its own, and the entire signed JWT is returned
+// in place of the signature. Use SignJwt or SignToken instead to get the token issued by the signJwt API.
+func (s *SigningMethodIAM) Sign(signingString string, key interface{}) ([]byte, error) {
 	var ctx context.Context
 
 	// check to make sure the key is a context.Context
@@ -41,32 +46,28 @@ func (s *SigningMethodIAM) Sign(signingString string, key interface{}) (string,
 	case context.Context:
 		ctx = k
 	default:
-		return "", jwt.ErrInvalidKey
+		return nil, jwt.ErrInvalidKey
 	}
 
 	// Get the IAMConfig from the context
 	config, ok := IAMFromContext(ctx)
 	if !ok {
-		return "", ErrMissingConfig
+		return nil, ErrMissingConfig
 	}
 
-	// Use the user provided IAMService or generate our own
-	iamService := config.IAMService
-	if iamService == nil {
-		var err error
-		iamService, err = iamcredentials.NewService(ctx)
-		if err != nil {
-			return "", err
-		}
+	iamService, err := getIAMService(ctx, config)
+	if err != nil {
+		return nil, err
 	}
 
 	// Do the call
-	return s.sign(ctx, iamService, config, signingString)
+	signature, _, err := s.sign(ctx, iamService, config, signingString)
+	return signature, err
 }
 
 type keyFuncHelper struct {
 	compareMethod func(j jwt.SigningMethod) bool
-	certificates  func(ctx context.Context, config *IAMConfig) (certificates, error)
+	certificates  func(ctx context.Context, config *IAMConfig, refresh bool) (Certificates, error)
 }
 
 var (
@@ -81,45 +82,150 @@ var (
 
 func (k *keyFuncHelper) verifyKeyfunc(ctx context.Context, config *IAMConfig) jwt.Keyfunc {
 	return func(token *jwt.Token) (interface{}, error) {
-		// Make sure we have the proper header alg
-		if !k.compareMethod(token.Method) {
-			return nil, fmt.Errorf("gcpjwt: unexpected signing method: %v", token.Header["alg"])
+		// Make sure we have the proper header alg, JWKS key sources may also be used with the standard algorithms
+		isIAMMethod := k.compareMethod(token.Method)
+		method := standardMethod(token.Method)
+		if !isIAMMethod && (config.KeySource != JWKSKeySource || !isStandardMethod(method)) {
+			return nil, fmt.Errorf("%w: %v", ErrUnexpectedSigningMethod, token.Header["alg"])
 		}
-		certs, err := k.certificates(ctx, config)
-		if err != nil {
-			return nil, fmt.Errorf("gcpjwt: could not get certificates: %v", err)
-		}
-		var certList []*rsa.PublicKey
-		kid, ok := token.Header["kid"].(string)
-		if ok {
-			if cert, ok := certs[kid]; ok {
+		var certList []crypto.PublicKey
+		kid, _ := token.Header["kid"].(string)
+		if kid != "" {
+			cert, err := k.certificate(ctx, config, kid)
+			if err != nil {
+				return nil, err
+			}
+			if cert != nil {
 				certList = append(certList, cert)
 			}
 		} else {
+			certs, err := k.certificates(ctx, config, false)
+			if err != nil {
+				return nil, err
+			}
 			for _, cert := range certs {
-				certList = append(certList, cert)
+				certList = append(certList, publicKeys(cert)...)
 			}
 		}
 
-		if len(certList) == 0 {
-			return nil, fmt.Errorf("gcpjwt: could not find certificate(s) for service account `%s` and key id `%s`", config.ServiceAccount, kid)
+		if isIAMMethod {
+			// The IAM signing methods verify against a list of RSA public keys
+			var rsaList []*rsa.PublicKey
+			for _, cert := range certList {
+				if keyMatchesMethod(cert, jwt.SigningMethodRS256) {
+					rsaList = append(rsaList, unwrapKey(cert).(*rsa.PublicKey))
+				}
+			}
+			if len(rsaList) == 0 {
+				return nil, &KeyNotFoundError{KeyID: kid, Issuer: config.ServiceAccount}
+			}
+			return rsaList, nil
 		}
 
-		return certList, nil
+		// The standard signing methods verify against a single key
+		var keyList []crypto.PublicKey
+		for _, cert := range certList {
+			if keyMatchesMethod(cert, method) {
+				keyList = append(keyList, unwrapKey(cert))
+			}
+		}
+		switch len(keyList) {
+		case 0:
+			return nil, &KeyNotFoundError{KeyID: kid, Issuer: config.keySourceURL()}
+		case 1:
+			return keyList[0], nil
+		default:
+			return nil, fmt.Errorf("gcpjwt: a key id is required to pick from multiple certificates for `%s`", config.keySourceURL())
+		}
 	}
 }
 
+// certificate will return the certificate for the provided key id, or nil if not found. If the key id is not found in
+// cached certificates, the certificates will be refreshed.
+func (k *keyFuncHelper) certificate(ctx context.Context, config *IAMConfig, kid string) (crypto.PublicKey, error) {
+	certs, err := k.certificates(ctx, config, false)
+	if err != nil {
+		return nil, err
+	}
+
+	cert, found := certs[kid]
+	if !found && config.EnableCache {
+		// The key may have been rotated since we cached the certificates, try and refresh them
+		certs, err = k.certificates(ctx, config, true)
+		if err != nil {
+			return nil, err
+		}
+		cert = certs[kid]
+	}
+
+	return cert, nil
+}
+
+// standardMethod will return the jwt standard signing method the provided method verifies signatures with, this allows
+// the Cloud KMS signing methods to be used to verify tokens after overriding a standard algorithm.
+func standardMethod(method jwt.SigningMethod) jwt.SigningMethod {
+	if kmsMethod, ok := method.(*SigningMethodKMS); ok {
+		return kmsMethod.override
+	}
+	return method
+}
+
+// isStandardMethod will return true for the jwt provided RSA, RSA-PSS, and ECDSA signing methods
+func isStandardMethod(method jwt.SigningMethod) bool {
+	switch method.(type) {
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS, *jwt.SigningMethodECDSA:
+		return true
+	}
+	return false
+}
+
+// keyMatchesMethod will return true if the public key can be used to verify signatures of the standard signing method,
+// keys from a JSON Web Key Set must also be declared for the method's algorithm if restricted to one
+func keyMatchesMethod(key crypto.PublicKey, method jwt.SigningMethod) bool {
+	if jwk, ok := key.(*jwkPublicKey); ok {
+		return jwk.alg == method.Alg() && keyMatchesMethod(jwk.key, method)
+	}
+
+	switch m := method.(type) {
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		_, ok := key.(*rsa.PublicKey)
+		return ok
+	case *jwt.SigningMethodECDSA:
+		ecdsaKey, ok := key.(*ecdsa.PublicKey)
+		return ok && ecdsaKey.Curve.Params().BitSize == m.CurveBits
+	case *jwt.SigningMethodEd25519:
+		_, ok := key.(ed25519.PublicKey)
+		return ok
+	case *SigningMethodSecp256k1:
+		_, ok := key.(*secp256k1.PublicKey)
+		return ok
+	}
+	return false
+}
+
 // IAMVerfiyKeyfunc is a helper meant that returns a jwt.Keyfunc. It will handle pulling and selecting the certificates
-// to verify signatures with, caching when enabled.
+// to verify signatures with, caching when enabled. When caching is enabled, a token with a key id not found in the
+// cached certificates will trigger a refresh of the certificates at most once every IAMConfig.MinRefreshInterval.
+// When using the JWKSKeySource, tokens signed with the standard RSA, RSA-PSS, and ECDSA signing methods are also
+// accepted and verified with the key matching the token's key id, or the only matching key if the token has no key
+// id. Keys declaring an algorithm in the JWKS only verify tokens signed with that algorithm, and keys without a key id
+// only verify tokens without a key id. Tokens parsed with a Cloud KMS signing method, after calling its Override, are
+// verified as the standard algorithm the method overrides.
 func IAMVerfiyKeyfunc(ctx context.Context, config *IAMConfig) jwt.Keyfunc {
 	return iamKeyfunc.verifyKeyfunc(ctx, config)
 }
 
-// Verify implements the Verify method from jwt.SigningMethod. This will expect key type of []*rsa.PublicKey.
+// Verify implements the Verify method from jwt.SigningMethod. This will expect key type of []*rsa.PublicKey or
+// *rsa.PublicKey.
 // https://firebase.google.com/docs/auth/admin/verify-id-tokens
-func (s *SigningMethodIAM) Verify(signingString, signature string, key interface{}) error {
-	rsaKeys, ok := key.([]*rsa.PublicKey)
-	if !ok {
+func (s *SigningMethodIAM) Verify(signingString string, signature []byte, key interface{}) error {
+	var rsaKeys []*rsa.PublicKey
+	switch k := key.(type) {
+	case []*rsa.PublicKey:
+		rsaKeys = k
+	case *rsa.PublicKey:
+		rsaKeys = []*rsa.PublicKey{k}
+	default:
 		return jwt.ErrInvalidKeyType
 	}
 
@@ -131,11 +237,5 @@ func (s *SigningMethodIAM) Verify(signingString, signature string, key interface
 		}
 	}
 
-	// TODO:
-	// If the certs can rotate before the cache expires, what should we do?
-	// Do we invalidate the cache if we cannot authenticate or would that
-	// enable a DDoS-like attack where every request fails the cache and
-	// the program keeps trying to fetch replacements. For now, do nothing.
-
 	return err
 }
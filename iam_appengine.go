@@ -5,7 +5,7 @@ import (
 	"sync"
 	"time"
 
-	"github.com/dgrijalva/jwt-go"
+	"github.com/golang-jwt/jwt/v5"
 	"google.golang.org/appengine"
 )
 
@@ -41,19 +41,25 @@ func init() {
 
 // Sign implements the Sign method from jwt.SigningMethod. For this signing method, a valid AppEngine context.Context
 // must be passed as the key.
-func (s *SigningMethodAppEngineImpl) Sign(signingString string, key interface{}) (string, error) {
+func (s *SigningMethodAppEngineImpl) Sign(signingString string, key interface{}) ([]byte, error) {
 	var ctx context.Context
 
 	switch k := key.(type) {
 	case context.Context:
 		ctx = k
 	default:
-		return "", jwt.ErrInvalidKey
+		return nil, jwt.ErrInvalidKey
 	}
 
+	signature, _, err := s.signBytes(ctx, signingString)
+	return signature, err
+}
+
+// signBytes will sign the signing string, returning the signature and the name of the key used to sign it
+func (s *SigningMethodAppEngineImpl) signBytes(ctx context.Context, signingString string) ([]byte, string, error) {
 	keyName, signature, err := appengine.SignBytes(ctx, []byte(signingString))
 	if err != nil {
-		return "", err
+		return nil, "", &SigningError{Name: appEngineSvcAcct, Err: err}
 	}
 
 	s.Lock()
@@ -61,11 +67,11 @@ func (s *SigningMethodAppEngineImpl) Sign(signingString string, key interface{})
 
 	s.lastKeyID = keyName
 
-	return jwt.EncodeSegment(signature), nil
+	return signature, keyName, nil
 }
 
 // KeyID will return the last used KeyID to sign the JWT.
-// Helper function for adding the kid header to your token.
+// Use SignToken to create tokens with the kid header set.
 func (s *SigningMethodAppEngineImpl) KeyID() string {
 	s.RLock()
 	defer s.RUnlock()
@@ -93,30 +99,24 @@ func AppEngineVerfiyKeyfunc(ctx context.Context, enableCache bool, cacheExpirati
 	return appEngineKeyfunc.verifyKeyfunc(ctx, config)
 }
 
-func getAppEngineCertificates(ctx context.Context, config *IAMConfig) (certificates, error) {
-	if config.EnableCache {
-		if certsResp, ok := getCertsFromCache(appEngineSvcAcct); ok {
-			return certsResp, nil
-		}
-	}
+func getAppEngineCertificates(ctx context.Context, config *IAMConfig, refresh bool) (Certificates, error) {
+	return cachedCertificates(ctx, config, appEngineSvcAcct, refresh, fetchAppEngineCertificates)
+}
 
+func fetchAppEngineCertificates(ctx context.Context, config *IAMConfig) (Certificates, time.Time, error) {
 	aeCerts, err := appengine.PublicCertificates(ctx)
 	if err != nil {
-		return nil, err
+		return nil, time.Time{}, &KeySourceError{Err: err}
 	}
 
-	certs := make(certificates)
+	certs := make(Certificates)
 	for _, cert := range aeCerts {
 		rsaKey, err := jwt.ParseRSAPublicKeyFromPEM([]byte(cert.Data))
 		if err != nil {
-			return nil, err
+			return nil, time.Time{}, &KeySourceError{Err: err}
 		}
 		certs[cert.KeyName] = rsaKey
 	}
 
-	if config.EnableCache {
-		updateCache(appEngineSvcAcct, certs, time.Now().Add(config.CacheExpiration))
-	}
-
-	return certs, nil
+	return certs, time.Now().Add(config.CacheExpiration), nil
 }
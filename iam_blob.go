@@ -3,9 +3,8 @@ package gcpjwt
 import (
 	"context"
 	"encoding/base64"
-	"fmt"
 
-	"github.com/dgrijalva/jwt-go"
+	"github.com/golang-jwt/jwt/v5"
 	"google.golang.org/api/iamcredentials/v1"
 )
 
@@ -26,28 +25,46 @@ func init() {
 	})
 }
 
-func signBlob(ctx context.Context, iamService *iamcredentials.Service, config *IAMConfig, signingString string) (string, error) {
+func signBlob(ctx context.Context, iamService *iamcredentials.Service, config *IAMConfig, signingString string) ([]byte, string, error) {
+	signature, keyID, err := signBlobBytes(ctx, iamService, config, []byte(signingString))
+	if err != nil {
+		return nil, "", err
+	}
+
+	config.Lock()
+	defer config.Unlock()
+
+	config.lastKeyID = keyID
+
+	return signature, keyID, nil
+}
+
+// signBlobBytes will sign the payload with the signBlob API, returning the signature and the key id used to sign it
+func signBlobBytes(ctx context.Context, iamService *iamcredentials.Service, config *IAMConfig, payload []byte) ([]byte, string, error) {
 	// Prepare the call
+	name, err := config.serviceAccountName()
+	if err != nil {
+		return nil, "", err
+	}
 	signReq := &iamcredentials.SignBlobRequest{
-		Payload: base64.StdEncoding.EncodeToString([]byte(signingString)),
+		Delegates: config.Delegates,
+		Payload:   base64.StdEncoding.EncodeToString(payload),
 	}
-	name := fmt.Sprintf("projects/-/serviceAccounts/%s", config.ServiceAccount)
 
 	// Do the call
-	signResp, err := iamService.Projects.ServiceAccounts.SignBlob(name, signReq).Context(ctx).Do()
+	var signResp *iamcredentials.SignBlobResponse
+	err = config.RetryPolicy.do(ctx, func() error {
+		signResp, err = iamService.Projects.ServiceAccounts.SignBlob(name, signReq).Context(ctx).Do()
+		return err
+	})
 	if err != nil {
-		return "", err
+		return nil, "", &SigningError{Name: name, Err: err}
 	}
 
-	config.Lock()
-	defer config.Unlock()
-
-	config.lastKeyID = signResp.KeyId
-
 	signature, err := base64.StdEncoding.DecodeString(signResp.SignedBlob)
 	if err != nil {
-		return "", err
+		return nil, "", err
 	}
 
-	return jwt.EncodeSegment(signature), nil
+	return signature, signResp.KeyId, nil
 }
@@ -2,10 +2,12 @@ package gcpjwt
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"strings"
 
-	"github.com/dgrijalva/jwt-go"
+	"github.com/golang-jwt/jwt/v5"
 	"google.golang.org/api/iamcredentials/v1"
 )
 
@@ -26,25 +28,80 @@ func init() {
 	})
 }
 
-func signJwt(ctx context.Context, iamService *iamcredentials.Service, config *IAMConfig, signingString string) (string, error) {
+func signJwt(ctx context.Context, iamService *iamcredentials.Service, config *IAMConfig, signingString string) ([]byte, string, error) {
 	// Prepare the call
 	// First decode the JSON string and discard the header
 	parts := strings.Split(signingString, ".")
 	if len(parts) != 2 {
-		return "", fmt.Errorf("gcpjwt: expected a 2 part string to sign, got %d parts", len(parts))
+		return nil, "", fmt.Errorf("gcpjwt: expected a 2 part string to sign, got %d parts", len(parts))
 	}
-	jwtClaimSet, err := jwt.DecodeSegment(parts[1])
+	jwtClaimSet, err := base64.RawURLEncoding.DecodeString(parts[1])
 	if err != nil {
-		return "", err
+		return nil, "", err
 	}
 
-	signReq := &iamcredentials.SignJwtRequest{Payload: string(jwtClaimSet)}
-	name := fmt.Sprintf("projects/-/serviceAccounts/%s", config.ServiceAccount)
+	signedJwt, keyID, err := signJwtPayload(ctx, iamService, config, string(jwtClaimSet))
+	if err != nil {
+		return nil, "", err
+	}
+
+	return []byte(signedJwt), keyID, nil
+}
+
+// SignJwt will sign the claims with the signJwt API using the service account of the IAMConfig carried by ctx (see
+// NewIAMContext). The compact token issued by the API is returned intact, including the header set by the API with the
+// kid of the service account key used, along with the parsed, unverified, token.
+// https://cloud.google.com/iam/docs/reference/credentials/rest/v1/projects.serviceAccounts/signJwt
+func SignJwt(ctx context.Context, claims jwt.Claims) (string, *jwt.Token, error) {
+	config, ok := IAMFromContext(ctx)
+	if !ok {
+		return "", nil, ErrMissingConfig
+	}
+
+	jwtClaimSet, err := json.Marshal(claims)
+	if err != nil {
+		return "", nil, err
+	}
+
+	iamService, err := getIAMService(ctx, config)
+	if err != nil {
+		return "", nil, err
+	}
+
+	signedJwt, _, err := signJwtPayload(ctx, iamService, config, string(jwtClaimSet))
+	if err != nil {
+		return "", nil, err
+	}
+
+	token, _, err := jwt.NewParser().ParseUnverified(signedJwt, jwt.MapClaims{})
+	if err != nil {
+		return "", nil, fmt.Errorf("gcpjwt: could not parse token issued by the signJwt API: %v", err)
+	}
+	token.Method = SigningMethodIAMJWT
+
+	return signedJwt, token, nil
+}
+
+// signJwtPayload will sign the JSON encoded claims with the signJwt API, returning the signed JWT and the key id used
+// to sign it
+func signJwtPayload(ctx context.Context, iamService *iamcredentials.Service, config *IAMConfig, jwtClaimSet string) (string, string, error) {
+	name, err := config.serviceAccountName()
+	if err != nil {
+		return "", "", err
+	}
+	signReq := &iamcredentials.SignJwtRequest{
+		Delegates: config.Delegates,
+		Payload:   jwtClaimSet,
+	}
 
 	// Do the call
-	signResp, err := iamService.Projects.ServiceAccounts.SignJwt(name, signReq).Context(ctx).Do()
+	var signResp *iamcredentials.SignJwtResponse
+	err = config.RetryPolicy.do(ctx, func() error {
+		signResp, err = iamService.Projects.ServiceAccounts.SignJwt(name, signReq).Context(ctx).Do()
+		return err
+	})
 	if err != nil {
-		return "", err
+		return "", "", &SigningError{Name: name, Err: err}
 	}
 
 	config.Lock()
@@ -52,5 +109,5 @@ func signJwt(ctx context.Context, iamService *iamcredentials.Service, config *IA
 
 	config.lastKeyID = signResp.KeyId
 
-	return signResp.SignedJwt, nil
+	return signResp.SignedJwt, signResp.KeyId, nil
 }
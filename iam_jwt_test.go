@@ -1,9 +1,13 @@
 package gcpjwt
 
 import (
+	"bytes"
 	"context"
+	"fmt"
+	"strings"
 	"testing"
 
+	"github.com/golang-jwt/jwt/v5"
 	"google.golang.org/api/iamcredentials/v1"
 )
 
@@ -17,7 +21,7 @@ func Test_signJwt(t *testing.T) {
 	tests := []struct {
 		name    string
 		args    args
-		want    string
+		want    []byte
 		wantErr bool
 	}{
 		{
@@ -28,7 +32,7 @@ func Test_signJwt(t *testing.T) {
 				nil,
 				"onepart",
 			},
-			"",
+			nil,
 			true,
 		},
 		{
@@ -39,20 +43,61 @@ func Test_signJwt(t *testing.T) {
 				nil,
 				"header.invalidclaims",
 			},
-			"",
+			nil,
 			true,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := signJwt(tt.args.ctx, tt.args.iamService, tt.args.config, tt.args.signingString)
+			got, _, err := signJwt(tt.args.ctx, tt.args.iamService, tt.args.config, tt.args.signingString)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("signJwt() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
-			if got != tt.want {
+			if !bytes.Equal(got, tt.want) {
 				t.Errorf("signJwt() = %v, want %v", got, tt.want)
 			}
 		})
 	}
 }
+
+func TestSignJwt_MissingConfig(t *testing.T) {
+	if _, _, err := SignJwt(context.Background(), jwt.MapClaims{}); err != ErrMissingConfig {
+		t.Errorf("SignJwt() error = %v, want %v", err, ErrMissingConfig)
+	}
+}
+
+func TestSignJwtAndVerify(t *testing.T) {
+	parts := strings.Split(jwtConfig.Email, "@")
+	config := &IAMConfig{
+		ServiceAccount: fmt.Sprintf("api-signer@%s", parts[1]),
+	}
+	ctx, err := newContextFunc()
+	if err != nil {
+		t.Errorf("could not get context: %v", err)
+		return
+	}
+
+	c := NewIAMContext(ctx, config)
+	signedJwt, token, err := SignJwt(c, &jwt.RegisteredClaims{Audience: []string{"https://example.com"}})
+	if err != nil {
+		t.Errorf("SignJwt() error = %v", err)
+		return
+	}
+	if token.Method != SigningMethodIAMJWT || token.Header["kid"] != config.KeyID() {
+		t.Errorf("SignJwt() unexpected token method %v or kid %v, want kid %v", token.Method.Alg(), token.Header["kid"], config.KeyID())
+	}
+	if token.Raw != signedJwt {
+		t.Errorf("SignJwt() parsed token %v does not match signed token %v", token.Raw, signedJwt)
+	}
+
+	key, err := IAMVerfiyKeyfunc(c, config)(token)
+	if err != nil {
+		t.Errorf("could not get key: %v", err)
+		return
+	}
+	parts = strings.Split(signedJwt, ".")
+	if err := token.Method.Verify(strings.Join(parts[0:2], "."), token.Signature, key); err != nil {
+		t.Errorf("could not verify token: %v", err)
+	}
+}
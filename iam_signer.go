@@ -0,0 +1,213 @@
+package gcpjwt
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"sync"
+)
+
+// IAMSigner signs bytes using the IAM signBlob API for the service account configured in an IAMConfig, allowing a
+// service account without a downloaded key to produce signed GCS URLs, detached signatures, and X.509 certificate
+// requests. Signatures are always RSASSA-PKCS1-v1_5 using SHA256.
+//
+// IAMSigner does not implement crypto.Signer: the signBlob API hashes the payload itself so it cannot sign the
+// digests crypto.Signer is given, and the service account key it signs with is only known after signing. It cannot be
+// used with crypto/tls, x509.CreateCertificate, or SSH, use CreateCertificateRequest for X.509 certificate requests or
+// a KMSSigner where a crypto.Signer is required.
+type IAMSigner struct {
+	ctx    context.Context
+	config *IAMConfig
+
+	mu        sync.RWMutex
+	keyID     string
+	publicKey crypto.PublicKey
+}
+
+// NewIAMSigner returns an IAMSigner for the service account configured in the provided IAMConfig. The provided
+// context.Context is used for all subsequent calls to the API.
+func NewIAMSigner(ctx context.Context, config *IAMConfig) *IAMSigner {
+	return &IAMSigner{
+		ctx:    ctx,
+		config: config,
+	}
+}
+
+// SignBytes will sign the provided bytes, not a digest of them, with the signBlob API. It is compatible with the
+// SignBytes field of storage.SignedURLOptions.
+func (s *IAMSigner) SignBytes(b []byte) ([]byte, error) {
+	signature, _, err := s.signBytes(b)
+	return signature, err
+}
+
+func (s *IAMSigner) signBytes(b []byte) ([]byte, string, error) {
+	iamService, err := getIAMService(s.ctx, s.config)
+	if err != nil {
+		return nil, "", err
+	}
+
+	signature, keyID, err := signBlobBytes(s.ctx, iamService, s.config, b)
+	if err != nil {
+		return nil, "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if keyID != s.keyID {
+		s.keyID = keyID
+		s.publicKey = nil
+	}
+
+	return signature, keyID, nil
+}
+
+// KeyID will return the key id of the service account key used for the last signature, or an empty string if nothing
+// has been signed yet.
+func (s *IAMSigner) KeyID() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.keyID
+}
+
+// Public returns the public key of the service account key used for the last signature, retrieved from the x509
+// metadata endpoint for the service account. Nil is returned if nothing has been signed yet or if the public key
+// could not be retrieved.
+func (s *IAMSigner) Public() crypto.PublicKey {
+	s.mu.RLock()
+	keyID, publicKey := s.keyID, s.publicKey
+	s.mu.RUnlock()
+
+	if keyID == "" || publicKey != nil {
+		return publicKey
+	}
+
+	publicKey, err := iamKeyfunc.certificate(s.ctx, s.config, keyID)
+	if err != nil || publicKey == nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.keyID == keyID {
+		s.publicKey = publicKey
+	}
+
+	return publicKey
+}
+
+// certificateRequestProbe is signed to find out which key the signBlob API signs with when nothing was signed yet
+var certificateRequestProbe = []byte("gcpjwt certificate request key probe")
+
+// CreateCertificateRequest will create a DER encoded X.509 certificate request, as x509.CreateCertificateRequest does,
+// for the public key of the service account key used by the signBlob API. The template's SignatureAlgorithm is ignored.
+// The signed part of the request contains the public key, which is only known once the signer has signed something,
+// so the first request made with a new IAMSigner makes an additional signBlob call.
+func (s *IAMSigner) CreateCertificateRequest(template *x509.CertificateRequest) ([]byte, error) {
+	if s.Public() == nil {
+		// The signBlob API does not tell which key it will sign with, so sign a probe to find out
+		if _, err := s.SignBytes(certificateRequestProbe); err != nil {
+			return nil, err
+		}
+	}
+
+	// The key used may change between calls if the service account's keys are rotated, so try once more if it does
+	for attempt := 0; attempt < 2; attempt++ {
+		keyID, publicKey := s.KeyID(), s.Public()
+		if publicKey == nil {
+			return nil, &KeyNotFoundError{KeyID: keyID, Issuer: s.config.ServiceAccount}
+		}
+
+		var signedKeyID string
+		csr, err := createCertificateRequest(template, publicKey, func(tbs []byte) ([]byte, error) {
+			var signature []byte
+			var err error
+			signature, signedKeyID, err = s.signBytes(tbs)
+			return signature, err
+		})
+		if err != nil {
+			return nil, err
+		}
+		if signedKeyID == keyID {
+			return csr, nil
+		}
+	}
+
+	return nil, fmt.Errorf("gcpjwt: service account `%s` key changed while signing certificate request", s.config.ServiceAccount)
+}
+
+// certificateRequest and tbsCertificateRequest mirror the ASN.1 structure of a PKCS #10 certificate request
+type certificateRequest struct {
+	Raw                asn1.RawContent
+	TBSCSR             asn1.RawValue
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	SignatureValue     asn1.BitString
+}
+
+type tbsCertificateRequest struct {
+	Raw           asn1.RawContent
+	Version       int
+	Subject       asn1.RawValue
+	PublicKey     asn1.RawValue
+	RawAttributes []asn1.RawValue `asn1:"tag:0"`
+}
+
+// oidSignatureSHA256WithRSA identifies RSASSA-PKCS1-v1_5 signatures using SHA256, as created by the signBlob API
+var oidSignatureSHA256WithRSA = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}
+
+// createCertificateRequest will create a DER encoded X.509 certificate request for the public key, signing the
+// encoded request info with sign which must return a SHA256 RSASSA-PKCS1-v1_5 signature of the bytes passed to it.
+func createCertificateRequest(template *x509.CertificateRequest, publicKey crypto.PublicKey, sign func(tbs []byte) ([]byte, error)) ([]byte, error) {
+	publicKeyInfo, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// Let the standard library encode the request using a throwaway key, then swap in our public key and signature
+	throwawayKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	tmpl := *template
+	tmpl.SignatureAlgorithm = x509.ECDSAWithSHA256
+	der, err := x509.CreateCertificateRequest(rand.Reader, &tmpl, throwawayKey)
+	if err != nil {
+		return nil, err
+	}
+
+	var csr certificateRequest
+	if _, err := asn1.Unmarshal(der, &csr); err != nil {
+		return nil, fmt.Errorf("gcpjwt: failed to parse certificate request: %v", err)
+	}
+	var tbs tbsCertificateRequest
+	if _, err := asn1.Unmarshal(csr.TBSCSR.FullBytes, &tbs); err != nil {
+		return nil, fmt.Errorf("gcpjwt: failed to parse certificate request info: %v", err)
+	}
+
+	tbs.Raw = nil
+	tbs.PublicKey = asn1.RawValue{FullBytes: publicKeyInfo}
+	tbsBytes, err := asn1.Marshal(tbs)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := sign(tbsBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	return asn1.Marshal(certificateRequest{
+		TBSCSR: asn1.RawValue{FullBytes: tbsBytes},
+		SignatureAlgorithm: pkix.AlgorithmIdentifier{
+			Algorithm:  oidSignatureSHA256WithRSA,
+			Parameters: asn1.NullRawValue,
+		},
+		SignatureValue: asn1.BitString{Bytes: signature, BitLength: len(signature) * 8},
+	})
+}
@@ -0,0 +1,114 @@
+package gcpjwt
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestIAMSignerSignAndVerify(t *testing.T) {
+	parts := strings.Split(jwtConfig.Email, "@")
+	config := &IAMConfig{
+		ServiceAccount: fmt.Sprintf("api-signer@%s", parts[1]),
+	}
+	ctx, err := newContextFunc()
+	if err != nil {
+		t.Errorf("could not get context: %v", err)
+		return
+	}
+
+	signer := NewIAMSigner(ctx, config)
+	if signer.Public() != nil {
+		t.Errorf("expected nil public key before signing")
+		return
+	}
+
+	message := []byte("test message")
+	signature, err := signer.SignBytes(message)
+	if err != nil {
+		t.Errorf("could not sign message: %v", err)
+		return
+	}
+
+	if signer.KeyID() == "" {
+		t.Errorf("expected non-empty key id after calling sign")
+		return
+	}
+
+	publicKey, ok := signer.Public().(*rsa.PublicKey)
+	if !ok {
+		t.Errorf("expected *rsa.PublicKey, got %T", signer.Public())
+		return
+	}
+
+	digest := sha256.Sum256(message)
+	if err := rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, digest[:], signature); err != nil {
+		t.Errorf("could not verify signature: %v", err)
+	}
+
+	der, err := signer.CreateCertificateRequest(&x509.CertificateRequest{Subject: pkix.Name{CommonName: config.ServiceAccount}})
+	if err != nil {
+		t.Errorf("could not create certificate request: %v", err)
+		return
+	}
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		t.Errorf("could not parse certificate request: %v", err)
+		return
+	}
+	if err := csr.CheckSignature(); err != nil {
+		t.Errorf("could not verify certificate request: %v", err)
+	}
+}
+
+func TestIAMSigner_NotCryptoSigner(t *testing.T) {
+	// The signBlob API cannot sign digests, so IAMSigner must not be mistaken for a crypto.Signer
+	var signer interface{} = NewIAMSigner(context.Background(), &IAMConfig{ServiceAccount: "invalid"})
+	if _, ok := signer.(crypto.Signer); ok {
+		t.Errorf("IAMSigner should not implement crypto.Signer")
+	}
+}
+
+func Test_createCertificateRequest(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Errorf("could not generate key: %v", err)
+		return
+	}
+
+	template := &x509.CertificateRequest{
+		Subject:            pkix.Name{CommonName: "test"},
+		DNSNames:           []string{"example.com"},
+		SignatureAlgorithm: x509.ECDSAWithSHA256,
+	}
+	der, err := createCertificateRequest(template, &privateKey.PublicKey, func(tbs []byte) ([]byte, error) {
+		digest := sha256.Sum256(tbs)
+		return rsa.SignPKCS1v15(rand.Reader, privateKey, crypto.SHA256, digest[:])
+	})
+	if err != nil {
+		t.Errorf("createCertificateRequest() error = %v", err)
+		return
+	}
+
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		t.Errorf("could not parse certificate request: %v", err)
+		return
+	}
+	if err := csr.CheckSignature(); err != nil {
+		t.Errorf("could not verify certificate request: %v", err)
+	}
+	if csr.Subject.CommonName != "test" || len(csr.DNSNames) != 1 || csr.DNSNames[0] != "example.com" {
+		t.Errorf("unexpected certificate request contents: %+v", csr)
+	}
+	if template.SignatureAlgorithm != x509.ECDSAWithSHA256 {
+		t.Errorf("template should not be modified")
+	}
+}
@@ -2,13 +2,14 @@ package gcpjwt
 
 import (
 	"context"
+	"encoding/base64"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"strings"
 	"testing"
 
-	"github.com/dgrijalva/jwt-go"
+	"github.com/golang-jwt/jwt/v5"
 	"golang.org/x/oauth2/google"
 	gjwt "golang.org/x/oauth2/jwt"
 	"google.golang.org/appengine"
@@ -100,9 +101,14 @@ func TestIAMInvalidVerify(t *testing.T) {
 	for _, data := range gcpTestData {
 		t.Run(data.name, func(t *testing.T) {
 			parts := strings.Split(data.tokenString, ".")
+			sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+			if err != nil {
+				t.Errorf("Error decoding signature: %v", err)
+				return
+			}
 
 			method := jwt.GetSigningMethod(data.alg)
-			err := method.Verify(strings.Join(parts[0:2], "."), parts[2], c)
+			err = method.Verify(strings.Join(parts[0:2], "."), sig, c)
 			if data.valid && err != nil {
 				t.Errorf("Error while verifying key: %v", err)
 			}
@@ -143,12 +149,12 @@ func TestIAMSignAndVerify(t *testing.T) {
 			token := new(jwt.Token)
 			if data.alg == "IAMJWT" {
 				// This returns the entire JWT, not just the signature!
-				token, parts, err = new(jwt.Parser).ParseUnverified(sig, &jwt.MapClaims{})
+				token, parts, err = new(jwt.Parser).ParseUnverified(string(sig), &jwt.MapClaims{})
 				if err != nil {
 					t.Errorf("Error parsing token: %v", token)
 					return
 				}
-				sig = parts[2]
+				sig = token.Signature
 			}
 
 			token.Method = method
@@ -0,0 +1,172 @@
+package gcpjwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+)
+
+// jsonWebKey is the subset of RFC 7517/7518 fields needed to use RSA and EC public keys for verification
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+
+	// RSA
+	N string `json:"n"`
+	E string `json:"e"`
+
+	// EC
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type jsonWebKeySet struct {
+	Keys []jsonWebKey `json:"keys"`
+}
+
+// jwkPublicKey is a public key from a JSON Web Key Set restricted to the algorithm declared by its alg parameter
+type jwkPublicKey struct {
+	key crypto.PublicKey
+	alg string
+}
+
+// jwkPublicKeys are the public keys of a JSON Web Key Set without a key id. They are stored together in Certificates
+// under an empty key id so they are only used to verify tokens without a key id.
+type jwkPublicKeys []crypto.PublicKey
+
+// publicKeys will return the public keys stored for a key id in Certificates
+func publicKeys(cert crypto.PublicKey) []crypto.PublicKey {
+	if keys, ok := cert.(jwkPublicKeys); ok {
+		return keys
+	}
+	return []crypto.PublicKey{cert}
+}
+
+// unwrapKey will return the public key to verify signatures with, without the algorithm it may be restricted to
+func unwrapKey(key crypto.PublicKey) crypto.PublicKey {
+	if jwk, ok := key.(*jwkPublicKey); ok {
+		return jwk.key
+	}
+	return key
+}
+
+var (
+	rsaAlgs = map[string]bool{
+		"RS256": true, "RS384": true, "RS512": true,
+		"PS256": true, "PS384": true, "PS512": true,
+	}
+	ecCurves = map[string]elliptic.Curve{
+		"P-256": elliptic.P256(),
+		"P-384": elliptic.P384(),
+		"P-521": elliptic.P521(),
+	}
+	ecAlgs = map[string]string{
+		"P-256": "ES256",
+		"P-384": "ES384",
+		"P-521": "ES512",
+	}
+)
+
+// parseJWKS will parse a JSON Web Key Set into Certificates. Only keys meant for signatures with a supported key type
+// and algorithm are used, keys declaring an algorithm are restricted to it. Keys without a key id are stored together
+// under an empty key id, see jwkPublicKeys.
+func parseJWKS(b []byte) (Certificates, error) {
+	var keySet jsonWebKeySet
+	if err := json.Unmarshal(b, &keySet); err != nil {
+		return nil, err
+	}
+
+	certs := make(Certificates)
+	for _, key := range keySet.Keys {
+		if key.Use != "" && key.Use != "sig" {
+			continue
+		}
+
+		var publicKey crypto.PublicKey
+		var err error
+		switch key.Kty {
+		case "RSA":
+			if key.Alg != "" && !rsaAlgs[key.Alg] {
+				continue
+			}
+			publicKey, err = key.rsaPublicKey()
+		case "EC":
+			if key.Alg != "" && ecAlgs[key.Crv] != key.Alg {
+				continue
+			}
+			publicKey, err = key.ecdsaPublicKey()
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("gcpjwt: could not parse JWK `%s`: %v", key.Kid, err)
+		}
+
+		if key.Alg != "" {
+			publicKey = &jwkPublicKey{key: publicKey, alg: key.Alg}
+		}
+		if key.Kid == "" {
+			keys, _ := certs[""].(jwkPublicKeys)
+			certs[""] = append(keys, publicKey)
+			continue
+		}
+		certs[key.Kid] = publicKey
+	}
+
+	return certs, nil
+}
+
+func (k *jsonWebKey) rsaPublicKey() (*rsa.PublicKey, error) {
+	n, err := decodeJWKInt(k.N)
+	if err != nil {
+		return nil, err
+	}
+	e, err := decodeJWKInt(k.E)
+	if err != nil {
+		return nil, err
+	}
+	if !e.IsInt64() || e.Int64() > 1<<31-1 {
+		return nil, fmt.Errorf("invalid exponent")
+	}
+
+	return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+}
+
+func (k *jsonWebKey) ecdsaPublicKey() (*ecdsa.PublicKey, error) {
+	curve, ok := ecCurves[k.Crv]
+	if !ok {
+		return nil, fmt.Errorf("unsupported curve `%s`", k.Crv)
+	}
+	x, err := decodeJWKInt(k.X)
+	if err != nil {
+		return nil, err
+	}
+	y, err := decodeJWKInt(k.Y)
+	if err != nil {
+		return nil, err
+	}
+	if !curve.IsOnCurve(x, y) {
+		return nil, fmt.Errorf("point is not on curve `%s`", k.Crv)
+	}
+
+	return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+}
+
+func decodeJWKInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == 0 {
+		return nil, fmt.Errorf("missing value")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,346 @@
+package gcpjwt
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func b64Int(i *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(i.Bytes())
+}
+
+func testJWKS(t *testing.T, rsaKey *rsa.PrivateKey, ecKey *ecdsa.PrivateKey) []byte {
+	b, err := json.Marshal(jsonWebKeySet{Keys: []jsonWebKey{
+		{Kty: "RSA", Kid: "rsa", Use: "sig", Alg: "RS256", N: b64Int(rsaKey.N), E: b64Int(big.NewInt(int64(rsaKey.E)))},
+		{Kty: "EC", Kid: "ec", Alg: "ES256", Crv: "P-256", X: b64Int(ecKey.X), Y: b64Int(ecKey.Y)},
+		{Kty: "RSA", Kid: "enc", Use: "enc", N: b64Int(rsaKey.N), E: b64Int(big.NewInt(int64(rsaKey.E)))},
+		{Kty: "EC", Kid: "wrong-alg", Alg: "ES384", Crv: "P-256", X: b64Int(ecKey.X), Y: b64Int(ecKey.Y)},
+		{Kty: "oct", Kid: "symmetric"},
+	}})
+	if err != nil {
+		t.Fatalf("could not marshal JWKS: %v", err)
+	}
+	return b
+}
+
+func Test_parseJWKS(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		jwks     []byte
+		wantKids []string
+		wantErr  bool
+	}{
+		{
+			"ValidSet",
+			testJWKS(t, rsaKey, ecKey),
+			[]string{"rsa", "ec"},
+			false,
+		},
+		{
+			"NoKid",
+			[]byte(`{"keys":[{"kty":"EC","crv":"P-256","x":"` + b64Int(ecKey.X) + `","y":"` + b64Int(ecKey.Y) + `"}]}`),
+			[]string{""},
+			false,
+		},
+		{
+			"PointNotOnCurve",
+			[]byte(`{"keys":[{"kty":"EC","kid":"bad","crv":"P-256","x":"AQ","y":"AQ"}]}`),
+			nil,
+			true,
+		},
+		{
+			"InvalidJSON",
+			[]byte(`{"keys":`),
+			nil,
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseJWKS(tt.jwks)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseJWKS() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if len(got) != len(tt.wantKids) {
+				t.Errorf("parseJWKS() got %d keys, want %d", len(got), len(tt.wantKids))
+			}
+			for _, kid := range tt.wantKids {
+				if _, ok := got[kid]; !ok {
+					t.Errorf("parseJWKS() missing key id `%s`", kid)
+				}
+			}
+		})
+	}
+}
+
+func TestIAMVerfiyKeyfunc_JWKS(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwks := testJWKS(t, rsaKey, ecKey)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+		_, _ = w.Write(jwks)
+	}))
+	defer server.Close()
+
+	config := &IAMConfig{
+		KeySource:    JWKSKeySource,
+		KeySourceURL: server.URL,
+		EnableCache:  true,
+	}
+	keyFunc := IAMVerfiyKeyfunc(context.Background(), config)
+
+	tests := []struct {
+		name    string
+		method  jwt.SigningMethod
+		kid     string
+		key     interface{}
+		wantErr bool
+	}{
+		{
+			"RS256",
+			jwt.SigningMethodRS256,
+			"rsa",
+			rsaKey,
+			false,
+		},
+		{
+			"ES256",
+			jwt.SigningMethodES256,
+			"ec",
+			ecKey,
+			false,
+		},
+		{
+			"ES256NoKid",
+			jwt.SigningMethodES256,
+			"",
+			ecKey,
+			false,
+		},
+		{
+			"AlgorithmNotDeclared",
+			jwt.SigningMethodPS256,
+			"rsa",
+			rsaKey,
+			true,
+		},
+		{
+			"MismatchedKeyType",
+			jwt.SigningMethodES256,
+			"rsa",
+			ecKey,
+			true,
+		},
+		{
+			"UnknownKid",
+			jwt.SigningMethodRS256,
+			"unknown",
+			rsaKey,
+			true,
+		},
+		{
+			"UnexpectedMethod",
+			jwt.SigningMethodHS256,
+			"rsa",
+			[]byte("secret"),
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := jwt.NewWithClaims(tt.method, jwt.MapClaims{"foo": "bar"})
+			if tt.kid != "" {
+				token.Header["kid"] = tt.kid
+			}
+			tokenString, err := token.SignedString(tt.key)
+			if err != nil {
+				t.Fatalf("could not sign token: %v", err)
+			}
+
+			if _, err = jwt.Parse(tokenString, keyFunc); (err != nil) != tt.wantErr {
+				t.Errorf("jwt.Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestIAMVerfiyKeyfunc_JWKSNoKid(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwks := []byte(`{"keys":[{"kty":"EC","crv":"P-256","x":"` + b64Int(ecKey.X) + `","y":"` + b64Int(ecKey.Y) + `"}]}`)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(jwks)
+	}))
+	defer server.Close()
+
+	keyFunc := IAMVerfiyKeyfunc(context.Background(), &IAMConfig{
+		KeySource:    JWKSKeySource,
+		KeySourceURL: server.URL,
+	})
+
+	tests := []struct {
+		name    string
+		kid     string
+		wantErr bool
+	}{
+		{
+			"NoKid",
+			"",
+			false,
+		},
+		{
+			"PositionalKid",
+			"0",
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{"foo": "bar"})
+			if tt.kid != "" {
+				token.Header["kid"] = tt.kid
+			}
+			tokenString, err := token.SignedString(ecKey)
+			if err != nil {
+				t.Fatalf("could not sign token: %v", err)
+			}
+
+			if _, err = jwt.Parse(tokenString, keyFunc); (err != nil) != tt.wantErr {
+				t.Errorf("jwt.Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestIAMVerfiyKeyfunc_JWKSKidRequired(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwks, err := json.Marshal(jsonWebKeySet{Keys: []jsonWebKey{
+		{Kty: "EC", Kid: "ec", Crv: "P-256", X: b64Int(ecKey.X), Y: b64Int(ecKey.Y)},
+		{Kty: "EC", Kid: "other", Crv: "P-256", X: b64Int(otherKey.X), Y: b64Int(otherKey.Y)},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(jwks)
+	}))
+	defer server.Close()
+
+	config := &IAMConfig{
+		KeySource:    JWKSKeySource,
+		KeySourceURL: server.URL,
+	}
+	tokenString, err := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{"foo": "bar"}).SignedString(ecKey)
+	if err != nil {
+		t.Fatalf("could not sign token: %v", err)
+	}
+
+	// Several keys could verify a token without a key id
+	if _, err = jwt.Parse(tokenString, IAMVerfiyKeyfunc(context.Background(), config)); err == nil {
+		t.Errorf("jwt.Parse() expected an error for a token without a key id")
+	}
+}
+
+func TestIAMVerfiyKeyfunc_JWKSOverriddenKMSMethod(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwks := testJWKS(t, rsaKey, ecKey)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(jwks)
+	}))
+	defer server.Close()
+
+	keyFunc := IAMVerfiyKeyfunc(context.Background(), &IAMConfig{
+		KeySource:    JWKSKeySource,
+		KeySourceURL: server.URL,
+	})
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{"foo": "bar"})
+	token.Header["kid"] = "rsa"
+	signingString, err := token.SigningString()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := jwt.SigningMethodRS256.Sign(signingString, rsaKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		method  *SigningMethodKMS
+		wantErr bool
+	}{
+		{
+			"OverriddenAlgorithm",
+			SigningMethodKMSRS256,
+			false,
+		},
+		{
+			"OtherAlgorithm",
+			SigningMethodKMSPS256,
+			true,
+		},
+		{
+			"MismatchedKeyType",
+			SigningMethodKMSES256,
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// jwt.Parse will use the Cloud KMS signing method for the token's alg once it is overridden
+			token.Method = tt.method
+			key, err := keyFunc(token)
+			if err == nil {
+				err = tt.method.Verify(signingString, sig, key)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("IAMVerfiyKeyfunc() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package jwtmiddleware
+
+import (
+	"context"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type tokenKey struct{}
+
+// NewTokenContext returns a new context.Context that carries the provided verified *jwt.Token, the middleware uses
+// this to pass the token to downstream handlers. Useful for testing handlers without the middleware.
+func NewTokenContext(ctx context.Context, token *jwt.Token) context.Context {
+	return context.WithValue(ctx, tokenKey{}, token)
+}
+
+// TokenFromContext extracts the verified *jwt.Token from the request context, if present. The token is absent for
+// requests let through without a token when using WithCredentialsOptional.
+func TokenFromContext(ctx context.Context) (*jwt.Token, bool) {
+	token, ok := ctx.Value(tokenKey{}).(*jwt.Token)
+	return token, ok && token != nil
+}
+
+// ClaimsFromContext extracts the verified token's claims from the request context, if present. The claims are of the
+// type returned by the WithClaims option, *jwt.RegisteredClaims by default.
+func ClaimsFromContext(ctx context.Context) (jwt.Claims, bool) {
+	token, ok := TokenFromContext(ctx)
+	if !ok {
+		return nil, false
+	}
+	return token.Claims, true
+}
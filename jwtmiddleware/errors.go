@@ -0,0 +1,84 @@
+package jwtmiddleware
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/golang-jwt/jwt/v5/request"
+)
+
+// ErrorHandler responds to a request that did not have a valid token, err describes why. Use StatusCode to pick the
+// response's status code.
+type ErrorHandler func(w http.ResponseWriter, r *http.Request, err error)
+
+// TextErrorHandler responds with the status text of the error's StatusCode as a plain text body, along with a
+// WWW-Authenticate header as described by RFC 6750. This is the default ErrorHandler.
+func TextErrorHandler(w http.ResponseWriter, _ *http.Request, err error) {
+	status := StatusCode(err)
+	if challenge := wwwAuthenticate(err, status); challenge != "" {
+		w.Header().Set("WWW-Authenticate", challenge)
+	}
+	http.Error(w, http.StatusText(status), status)
+}
+
+// ProblemJSONErrorHandler responds with an application/problem+json body as described by RFC 7807, along with a
+// WWW-Authenticate header as described by RFC 6750.
+func ProblemJSONErrorHandler(w http.ResponseWriter, _ *http.Request, err error) {
+	status := StatusCode(err)
+	if challenge := wwwAuthenticate(err, status); challenge != "" {
+		w.Header().Set("WWW-Authenticate", challenge)
+	}
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+
+	_ = json.NewEncoder(w).Encode(struct {
+		Type   string `json:"type"`
+		Title  string `json:"title"`
+		Status int    `json:"status"`
+		Detail string `json:"detail"`
+	}{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: errorDescription(err, status),
+	})
+}
+
+// wwwAuthenticate will return the Bearer challenge for the error, or an empty string if it is not an authentication
+// error. Requests without a token are not given an error code, as RFC 6750 recommends.
+func wwwAuthenticate(err error, status int) string {
+	switch {
+	case errors.Is(err, request.ErrNoTokenInRequest):
+		return "Bearer"
+	case status == http.StatusUnauthorized:
+		return fmt.Sprintf(`Bearer error="invalid_token", error_description="%s"`, errorDescription(err, status))
+	case status == http.StatusForbidden:
+		return fmt.Sprintf(`Bearer error="insufficient_scope", error_description="%s"`, errorDescription(err, status))
+	default:
+		return ""
+	}
+}
+
+// errorDescription will return a description of the error safe to share with the client
+func errorDescription(err error, status int) string {
+	switch {
+	case status == http.StatusServiceUnavailable:
+		return "The access token could not be verified at this time"
+	case errors.Is(err, request.ErrNoTokenInRequest):
+		return "The request is missing an access token"
+	case errors.Is(err, jwt.ErrTokenExpired):
+		return "The access token expired"
+	case errors.Is(err, jwt.ErrTokenNotValidYet), errors.Is(err, jwt.ErrTokenUsedBeforeIssued):
+		return "The access token is not valid yet"
+	case errors.Is(err, jwt.ErrTokenInvalidAudience):
+		return "The access token is not valid for this audience"
+	case errors.Is(err, jwt.ErrTokenInvalidIssuer):
+		return "The access token was not issued by a trusted issuer"
+	default:
+		return "The access token is invalid"
+	}
+}
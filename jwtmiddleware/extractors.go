@@ -0,0 +1,34 @@
+package jwtmiddleware
+
+import (
+	"net/http"
+
+	"github.com/golang-jwt/jwt/v5/request"
+)
+
+// CookieExtractor extracts a token from the cookie with the provided name.
+type CookieExtractor string
+
+// ExtractToken implements request.Extractor
+func (e CookieExtractor) ExtractToken(r *http.Request) (string, error) {
+	cookie, err := r.Cookie(string(e))
+	if err != nil || cookie.Value == "" {
+		return "", request.ErrNoTokenInRequest
+	}
+	return cookie.Value, nil
+}
+
+// QueryExtractor extracts a token from the first of the provided URL query parameters found. Unlike
+// request.ArgumentExtractor, the request body is never parsed.
+type QueryExtractor []string
+
+// ExtractToken implements request.Extractor
+func (e QueryExtractor) ExtractToken(r *http.Request) (string, error) {
+	query := r.URL.Query()
+	for _, param := range e {
+		if token := query.Get(param); token != "" {
+			return token, nil
+		}
+	}
+	return "", request.ErrNoTokenInRequest
+}
@@ -0,0 +1,123 @@
+package jwtmiddleware
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/golang-jwt/jwt/v5/request"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	gcpjwt "github.com/someone1/gcp-jwt-go/v3"
+)
+
+// UnaryServerInterceptor will return a grpc.UnaryServerInterceptor that will try and validate tokens in incoming
+// calls the same way New does for HTTP requests. The token is expected as a Bearer token in the authorization
+// metadata, the WithExtractors and WithErrorHandler options are ignored. Unless WithAudience is used, the Audience
+// claim is validated to https:// + the call's :authority, optionally followed by the service name as gRPC per-RPC
+// credentials do (e.g. https://example.com/package.Service). Calls without a valid token fail with
+// codes.Unauthenticated, codes.PermissionDenied for a token for another audience or issuer, or codes.Unavailable if
+// the keys needed to verify the token could not be retrieved. The verified token is passed to the handler in its
+// context, see TokenFromContext and ClaimsFromContext. As with New, the config may only be nil if WithKeyfunc is used.
+func UnaryServerInterceptor(ctx context.Context, config *gcpjwt.IAMConfig, opts ...Option) grpc.UnaryServerInterceptor {
+	v := newVerifier(ctx, config, opts)
+
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := v.verifyRPC(ctx, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor will return a grpc.StreamServerInterceptor that will try and validate tokens in incoming
+// streams, see UnaryServerInterceptor.
+func StreamServerInterceptor(ctx context.Context, config *gcpjwt.IAMConfig, opts ...Option) grpc.StreamServerInterceptor {
+	v := newVerifier(ctx, config, opts)
+
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := v.verifyRPC(ss.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// serverStream overrides the context of a grpc.ServerStream
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+// verifyRPC will verify the token in the call's incoming metadata, returning the context to pass to the handler or a
+// gRPC status error.
+func (v *verifier) verifyRPC(ctx context.Context, fullMethod string) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	tokenString, err := bearerToken(md)
+	if err == request.ErrNoTokenInRequest && v.credentialsOptional {
+		return ctx, nil
+	}
+
+	audiences := []string{v.audience}
+	if v.audience == "" {
+		authority := md.Get(":authority")
+		if len(authority) == 0 || authority[0] == "" {
+			return nil, status.Error(codes.Unauthenticated, "missing :authority to validate the access token's audience")
+		}
+		audiences = rpcAudiences(authority[0], fullMethod)
+	}
+
+	var token *jwt.Token
+	if err == nil {
+		token, err = v.verify(tokenString, audiences...)
+	}
+	if err != nil {
+		httpStatus := StatusCode(err)
+		return nil, status.Error(grpcCode(httpStatus), errorDescription(err, httpStatus))
+	}
+
+	return NewTokenContext(ctx, token), nil
+}
+
+// bearerToken will return the Bearer token from the authorization metadata
+func bearerToken(md metadata.MD) (string, error) {
+	for _, value := range md.Get("authorization") {
+		if len(value) > 7 && strings.EqualFold(value[:7], "bearer ") {
+			return value[7:], nil
+		}
+	}
+	return "", request.ErrNoTokenInRequest
+}
+
+// rpcAudiences will return the audiences accepted for a call to the method on the authority: the authority itself and
+// the audience gRPC per-RPC credentials are given, the authority followed by the service name.
+func rpcAudiences(authority, fullMethod string) []string {
+	base := "https://" + strings.TrimSuffix(authority, ":443")
+	audiences := []string{base}
+	if pos := strings.LastIndex(fullMethod, "/"); pos > 0 {
+		audiences = append(audiences, base+fullMethod[:pos])
+	}
+	return audiences
+}
+
+// grpcCode will return the gRPC status code matching the HTTP status code returned by StatusCode
+func grpcCode(httpStatus int) codes.Code {
+	switch httpStatus {
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusServiceUnavailable:
+		return codes.Unavailable
+	default:
+		return codes.Unauthenticated
+	}
+}
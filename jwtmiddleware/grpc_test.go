@@ -0,0 +1,108 @@
+package jwtmiddleware
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	gcpjwt "github.com/someone1/gcp-jwt-go/v3"
+)
+
+type testServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *testServerStream) Context() context.Context {
+	return s.ctx
+}
+
+func TestServerInterceptors(t *testing.T) {
+	const (
+		issuer     = "issuer@example.iam.gserviceaccount.com"
+		fullMethod = "/package.Service/Method"
+	)
+	secret := []byte("secret")
+	signed := func(iss, aud string) string {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, &jwt.RegisteredClaims{
+			Issuer:    iss,
+			Subject:   "subject",
+			Audience:  jwt.ClaimStrings{aud},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		}).SignedString(secret)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	config := &gcpjwt.IAMConfig{ServiceAccount: issuer}
+	keyFunc := WithKeyfunc(func(*jwt.Token) (interface{}, error) { return secret, nil })
+
+	tests := []struct {
+		name string
+		opts []Option
+		md   metadata.MD
+		want codes.Code
+	}{
+		{"MissingToken", nil, metadata.Pairs(":authority", "example.com"), codes.Unauthenticated},
+		{"Authority", nil, metadata.Pairs(":authority", "example.com", "authorization", "Bearer "+signed(issuer, "https://example.com")), codes.OK},
+		{"AuthorityService", nil, metadata.Pairs(":authority", "example.com:443", "authorization", "bearer "+signed(issuer, "https://example.com/package.Service")), codes.OK},
+		{"InvalidAudience", nil, metadata.Pairs(":authority", "example.com", "authorization", "Bearer "+signed(issuer, "https://invalid.com")), codes.PermissionDenied},
+		{"InvalidIssuer", nil, metadata.Pairs(":authority", "example.com", "authorization", "Bearer "+signed("other", "https://example.com")), codes.PermissionDenied},
+		{"MissingAuthority", nil, metadata.Pairs("authorization", "Bearer "+signed(issuer, "https://example.com")), codes.Unauthenticated},
+		{"Audience", []Option{WithAudience("https://api")}, metadata.Pairs("authorization", "Bearer "+signed(issuer, "https://api")), codes.OK},
+		{"InvalidToken", nil, metadata.Pairs(":authority", "example.com", "authorization", "Bearer invalid"), codes.Unauthenticated},
+		{"CredentialsOptional", []Option{WithCredentialsOptional()}, metadata.Pairs(":authority", "example.com"), codes.OK},
+		{
+			"KeySourceUnavailable",
+			[]Option{WithKeyfunc(func(*jwt.Token) (interface{}, error) {
+				return nil, &gcpjwt.KeySourceError{Err: errors.New("unavailable")}
+			})},
+			metadata.Pairs(":authority", "example.com", "authorization", "Bearer "+signed(issuer, "https://example.com")),
+			codes.Unavailable,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := append([]Option{keyFunc}, tt.opts...)
+			ctx := metadata.NewIncomingContext(context.Background(), tt.md)
+			wantClaims := tt.want == codes.OK && tt.md.Get("authorization") != nil
+
+			checkClaims := func(ctx context.Context) {
+				claims, ok := ClaimsFromContext(ctx)
+				if ok != wantClaims {
+					t.Errorf("ClaimsFromContext() ok = %v, want %v", ok, wantClaims)
+					return
+				}
+				if ok && claims.(*jwt.RegisteredClaims).Subject != "subject" {
+					t.Errorf("ClaimsFromContext() = %v, want the verified claims", claims)
+				}
+			}
+
+			unary := UnaryServerInterceptor(context.Background(), config, opts...)
+			_, err := unary(ctx, nil, &grpc.UnaryServerInfo{FullMethod: fullMethod}, func(ctx context.Context, _ interface{}) (interface{}, error) {
+				checkClaims(ctx)
+				return nil, nil
+			})
+			if got := status.Code(err); got != tt.want {
+				t.Errorf("UnaryServerInterceptor() code = %v, want %v (%v)", got, tt.want, err)
+			}
+
+			stream := StreamServerInterceptor(context.Background(), config, opts...)
+			err = stream(nil, &testServerStream{ctx: ctx}, &grpc.StreamServerInfo{FullMethod: fullMethod}, func(_ interface{}, ss grpc.ServerStream) error {
+				checkClaims(ss.Context())
+				return nil
+			})
+			if got := status.Code(err); got != tt.want {
+				t.Errorf("StreamServerInterceptor() code = %v, want %v (%v)", got, tt.want, err)
+			}
+		})
+	}
+}
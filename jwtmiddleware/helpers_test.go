@@ -17,8 +17,8 @@ import (
 	"google.golang.org/appengine"
 	"google.golang.org/appengine/aetest"
 
-	gcpjwt "github.com/someone1/gcp-jwt-go/v2"
-	goauth2 "github.com/someone1/gcp-jwt-go/v2/oauth2"
+	gcpjwt "github.com/someone1/gcp-jwt-go/v3"
+	goauth2 "github.com/someone1/gcp-jwt-go/v3/oauth2"
 )
 
 var jwtConfig *gjwt.Config
@@ -2,48 +2,144 @@ package jwtmiddleware
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 
-	"github.com/dgrijalva/jwt-go"
-	"github.com/dgrijalva/jwt-go/request"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/golang-jwt/jwt/v5/request"
 
-	gcpjwt "github.com/someone1/gcp-jwt-go/v2"
+	gcpjwt "github.com/someone1/gcp-jwt-go/v3"
 )
 
 // NewHandler will return a middleware that will try and validate tokens in incoming HTTP requests.
 // The token is expected as a Bearer token in the Authorization header and expected to have an Issuer
 // claim equal to the ServiceAccount the provided IAMConfig is configured for. This will also validate the
 // Audience claim to the one provided, or use https:// + request.Host if blank. NOTE: If using the signJwt method,
-// you MUST call gcpjwt.SigningMethodIAMJWT.Override().
+// you MUST call gcpjwt.SigningMethodIAMJWT.Override(). Requests with a token for another audience or issuer are
+// rejected with a 403, a 503 is returned if the service account's certificates could not be retrieved, and a 401
+// otherwise.
 //
 // Complimentary to https://github.com/someone1/gcp-jwt-go/oauth2
 func NewHandler(ctx context.Context, config *gcpjwt.IAMConfig, audience string) func(http.Handler) http.Handler {
-	ctx = gcpjwt.NewIAMContext(ctx, config)
+	return New(ctx, config, WithAudience(audience))
+}
 
-	keyFunc := gcpjwt.IAMVerfiyKeyfunc(ctx, config)
+// New will return a middleware that will try and validate tokens in incoming HTTP requests, verifying them with the
+// public keys of the provided IAMConfig. Without any options, it behaves as NewHandler does with a blank audience.
+// See Option for how to customize where tokens are extracted from, which claims are parsed, which issuers and audience
+// are accepted, and how errors are responded to. The verified token is passed to the handler in the request's context,
+// see TokenFromContext and ClaimsFromContext. The config may be nil if WithKeyfunc is used, in which case the issuer
+// is only validated if WithIssuers is used. New panics if neither a config nor WithKeyfunc is provided.
+func New(ctx context.Context, config *gcpjwt.IAMConfig, opts ...Option) func(http.Handler) http.Handler {
+	v := newVerifier(ctx, config, opts)
 
 	return func(h http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			claims := &jwt.StandardClaims{}
-
-			token, err := request.ParseFromRequest(r, request.AuthorizationHeaderExtractor, keyFunc, request.WithClaims(claims))
-			if err != nil || !token.Valid {
-				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
-				return
-			}
-
-			aud := audience
+			aud := v.audience
 			if aud == "" {
 				aud = fmt.Sprintf("https://%s", r.Host)
 			}
 
-			if !claims.VerifyAudience(aud, true) || !claims.VerifyIssuer(config.ServiceAccount, true) {
-				http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			tokenString, err := v.extractor.ExtractToken(r)
+			if errors.Is(err, request.ErrNoTokenInRequest) && v.credentialsOptional {
+				h.ServeHTTP(w, r)
+				return
+			}
+			var token *jwt.Token
+			if err == nil {
+				token, err = v.verify(tokenString, aud)
+			}
+			if err != nil {
+				v.errorHandler(w, r, err)
 				return
 			}
 
-			h.ServeHTTP(w, r)
+			h.ServeHTTP(w, r.WithContext(NewTokenContext(r.Context(), token)))
 		})
 	}
 }
+
+// verifier is the token verification shared by the HTTP middleware and the gRPC interceptors
+type verifier struct {
+	*options
+	keyFunc jwt.Keyfunc
+}
+
+func newVerifier(ctx context.Context, config *gcpjwt.IAMConfig, opts []Option) *verifier {
+	o := &options{
+		extractor:    request.AuthorizationHeaderExtractor,
+		claims:       func() jwt.Claims { return &jwt.RegisteredClaims{} },
+		errorHandler: TextErrorHandler,
+	}
+	if config != nil {
+		o.issuers = []string{config.ServiceAccount}
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	keyFunc := o.keyFunc
+	if keyFunc == nil {
+		if config == nil {
+			panic("jwtmiddleware: an IAMConfig or the WithKeyfunc option is required")
+		}
+		keyFunc = gcpjwt.IAMVerfiyKeyfunc(gcpjwt.NewIAMContext(ctx, config), config)
+	}
+
+	return &verifier{
+		options: o,
+		keyFunc: keyFunc,
+	}
+}
+
+// verify will parse and verify the token, validating it was issued for one of the audiences by an allowed issuer
+func (v *verifier) verify(tokenString string, audiences ...string) (*jwt.Token, error) {
+	parser := jwt.NewParser(jwt.WithAudience(audiences...))
+	token, err := parser.ParseWithClaims(tokenString, v.claims(), v.keyFunc)
+	if err == nil && !token.Valid {
+		err = jwt.ErrTokenUnverifiable
+	}
+	if err == nil {
+		err = v.validateIssuer(token)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// validateIssuer will return an error wrapping jwt.ErrTokenInvalidIssuer if the token's issuer is not allowed
+func (o *options) validateIssuer(token *jwt.Token) error {
+	if len(o.issuers) == 0 {
+		return nil
+	}
+
+	issuer, err := token.Claims.GetIssuer()
+	if err != nil {
+		return err
+	}
+
+	for _, allowed := range o.issuers {
+		if issuer == allowed {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: `%s` is not an allowed issuer", jwt.ErrTokenInvalidIssuer, issuer)
+}
+
+// StatusCode will return the HTTP status code to respond with when a token could not be validated: 403 for tokens
+// that were verified but not meant for us, 503 when the keys or backend needed to verify the token were unavailable,
+// and 401 otherwise.
+func StatusCode(err error) int {
+	switch {
+	case errors.Is(err, jwt.ErrTokenInvalidAudience), errors.Is(err, jwt.ErrTokenInvalidIssuer):
+		return http.StatusForbidden
+	case errors.Is(err, gcpjwt.ErrKeySourceUnavailable), errors.Is(err, gcpjwt.ErrSigningBackend):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusUnauthorized
+	}
+}
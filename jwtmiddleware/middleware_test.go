@@ -0,0 +1,290 @@
+package jwtmiddleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/golang-jwt/jwt/v5/request"
+
+	gcpjwt "github.com/someone1/gcp-jwt-go/v3"
+)
+
+func TestStatusCode(t *testing.T) {
+	token, err := jwt.New(jwt.SigningMethodHS256).SignedString([]byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		keyFuncErr error
+		want       int
+	}{
+		{"KeyNotFound", &gcpjwt.KeyNotFoundError{KeyID: "kid", Issuer: "issuer"}, http.StatusUnauthorized},
+		{"UnexpectedSigningMethod", gcpjwt.ErrUnexpectedSigningMethod, http.StatusUnauthorized},
+		{"UnknownIssuer", gcpjwt.ErrUnknownIssuer, http.StatusUnauthorized},
+		{"KeySourceUnavailable", &gcpjwt.KeySourceError{Source: "https://example.com", Err: errors.New("unavailable")}, http.StatusServiceUnavailable},
+		{"SigningBackend", &gcpjwt.SigningError{Name: "key", Err: errors.New("unavailable")}, http.StatusServiceUnavailable},
+		{"InvalidAudience", jwt.ErrTokenInvalidAudience, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := jwt.Parse(token, func(*jwt.Token) (interface{}, error) {
+				return nil, tt.keyFuncErr
+			})
+			if got := StatusCode(err); got != tt.want {
+				t.Errorf("StatusCode(%v) = %v, want %v", err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	const (
+		issuer   = "issuer@example.iam.gserviceaccount.com"
+		audience = "https://example.com"
+	)
+	secret := []byte("secret")
+	keyFunc := func(*jwt.Token) (interface{}, error) { return secret, nil }
+	signed := func(iss, aud string, expires time.Time) string {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, &jwt.RegisteredClaims{
+			Issuer:    iss,
+			Audience:  jwt.ClaimStrings{aud},
+			ExpiresAt: jwt.NewNumericDate(expires),
+		}).SignedString(secret)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	valid := signed(issuer, audience, time.Now().Add(time.Hour))
+	config := &gcpjwt.IAMConfig{ServiceAccount: issuer}
+	defaults := []Option{WithAudience(audience), WithKeyfunc(keyFunc)}
+
+	tests := []struct {
+		name       string
+		opts       []Option
+		setup      func(r *http.Request)
+		want       int
+		wantHeader string
+	}{
+		{"MissingToken", nil, func(r *http.Request) {}, http.StatusUnauthorized, "Bearer"},
+		{"Valid", nil, func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+valid) }, http.StatusOK, ""},
+		{
+			"Expired",
+			nil,
+			func(r *http.Request) {
+				r.Header.Set("Authorization", "Bearer "+signed(issuer, audience, time.Now().Add(-time.Hour)))
+			},
+			http.StatusUnauthorized,
+			`Bearer error="invalid_token", error_description="The access token expired"`,
+		},
+		{
+			"InvalidAudience",
+			nil,
+			func(r *http.Request) {
+				r.Header.Set("Authorization", "Bearer "+signed(issuer, "https://invalid", time.Now().Add(time.Hour)))
+			},
+			http.StatusForbidden,
+			`Bearer error="insufficient_scope", error_description="The access token is not valid for this audience"`,
+		},
+		{
+			"InvalidIssuer",
+			nil,
+			func(r *http.Request) {
+				r.Header.Set("Authorization", "Bearer "+signed("other", audience, time.Now().Add(time.Hour)))
+			},
+			http.StatusForbidden,
+			`Bearer error="insufficient_scope", error_description="The access token was not issued by a trusted issuer"`,
+		},
+		{
+			"AllowedIssuers",
+			[]Option{WithIssuers(issuer, "other")},
+			func(r *http.Request) {
+				r.Header.Set("Authorization", "Bearer "+signed("other", audience, time.Now().Add(time.Hour)))
+			},
+			http.StatusOK,
+			"",
+		},
+		{
+			"CookieExtractor",
+			[]Option{WithExtractors(request.AuthorizationHeaderExtractor, CookieExtractor("token"))},
+			func(r *http.Request) { r.AddCookie(&http.Cookie{Name: "token", Value: valid}) },
+			http.StatusOK,
+			"",
+		},
+		{
+			"QueryExtractorFirst",
+			[]Option{WithExtractors(QueryExtractor{"access_token"}, request.AuthorizationHeaderExtractor)},
+			func(r *http.Request) {
+				r.URL.RawQuery = "access_token=invalid"
+				r.Header.Set("Authorization", "Bearer "+valid)
+			},
+			http.StatusUnauthorized,
+			`Bearer error="invalid_token", error_description="The access token is invalid"`,
+		},
+		{
+			"CustomHeaderExtractor",
+			[]Option{WithExtractors(request.HeaderExtractor{"X-Token"})},
+			func(r *http.Request) { r.Header.Set("X-Token", valid) },
+			http.StatusOK,
+			"",
+		},
+		{"CredentialsOptional", []Option{WithCredentialsOptional()}, func(r *http.Request) {}, http.StatusOK, ""},
+		{
+			"CredentialsOptionalInvalid",
+			[]Option{WithCredentialsOptional()},
+			func(r *http.Request) { r.Header.Set("Authorization", "Bearer invalid") },
+			http.StatusUnauthorized,
+			`Bearer error="invalid_token", error_description="The access token is invalid"`,
+		},
+		{
+			"KeySourceUnavailable",
+			[]Option{WithKeyfunc(func(*jwt.Token) (interface{}, error) {
+				return nil, &gcpjwt.KeySourceError{Err: errors.New("unavailable")}
+			})},
+			func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+valid) },
+			http.StatusServiceUnavailable,
+			"",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := New(context.Background(), config, append(defaults, tt.opts...)...)(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				_, _ = w.Write([]byte("ok"))
+			}))
+
+			r := httptest.NewRequest(http.MethodGet, audience, nil)
+			tt.setup(r)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != tt.want {
+				t.Errorf("New() status = %v, want %v", w.Code, tt.want)
+			}
+			if got := w.Header().Get("WWW-Authenticate"); got != tt.wantHeader {
+				t.Errorf("New() WWW-Authenticate = %v, want %v", got, tt.wantHeader)
+			}
+		})
+	}
+}
+
+func TestNew_Options(t *testing.T) {
+	secret := []byte("secret")
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"iss": "issuer", "aud": "https://example.com"}).SignedString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claimsCalls := 0
+	handler := New(context.Background(), &gcpjwt.IAMConfig{ServiceAccount: "other"},
+		WithAudience("https://example.com"),
+		WithKeyfunc(func(*jwt.Token) (interface{}, error) { return secret, nil }),
+		WithClaims(func() jwt.Claims {
+			claimsCalls++
+			return jwt.MapClaims{}
+		}),
+		WithErrorHandler(ProblemJSONErrorHandler),
+	)(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {}))
+
+	r := httptest.NewRequest(http.MethodGet, "https://example.com", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	if claimsCalls != 1 {
+		t.Errorf("expected the claims factory to be called once, got %d", claimsCalls)
+	}
+	if w.Code != http.StatusForbidden || !strings.HasPrefix(w.Header().Get("Content-Type"), "application/problem+json") {
+		t.Errorf("unexpected response %v with content type %v", w.Code, w.Header().Get("Content-Type"))
+	}
+
+	var problem struct {
+		Type   string `json:"type"`
+		Title  string `json:"title"`
+		Status int    `json:"status"`
+		Detail string `json:"detail"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&problem); err != nil {
+		t.Errorf("could not decode problem: %v", err)
+		return
+	}
+	if problem.Status != http.StatusForbidden || problem.Title != http.StatusText(http.StatusForbidden) || problem.Detail == "" {
+		t.Errorf("unexpected problem %+v", problem)
+	}
+}
+
+func TestNew_Context(t *testing.T) {
+	secret := []byte("secret")
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, &jwt.RegisteredClaims{
+		Issuer:   "issuer",
+		Subject:  "subject",
+		Audience: jwt.ClaimStrings{"https://example.com"},
+	})
+	token.Header["kid"] = "key"
+	signed, err := token.SignedString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var gotToken *jwt.Token
+	var gotClaims jwt.Claims
+	var hasToken, hasClaims bool
+	handler := New(context.Background(), &gcpjwt.IAMConfig{ServiceAccount: "issuer"},
+		WithAudience("https://example.com"),
+		WithKeyfunc(func(*jwt.Token) (interface{}, error) { return secret, nil }),
+		WithCredentialsOptional(),
+	)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotToken, hasToken = TokenFromContext(r.Context())
+		gotClaims, hasClaims = ClaimsFromContext(r.Context())
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "https://example.com", nil)
+	r.Header.Set("Authorization", "Bearer "+signed)
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	if !hasToken || !gotToken.Valid || gotToken.Header["kid"] != "key" {
+		t.Errorf("TokenFromContext() = %v, %v, want the verified token", gotToken, hasToken)
+	}
+	claims, ok := gotClaims.(*jwt.RegisteredClaims)
+	if !hasClaims || !ok || claims.Subject != "subject" {
+		t.Errorf("ClaimsFromContext() = %v, %v, want *jwt.RegisteredClaims with the subject", gotClaims, hasClaims)
+	}
+
+	// Requests let through without a token have no token or claims
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "https://example.com", nil))
+	if hasToken || hasClaims {
+		t.Errorf("expected no token or claims for a request without a token")
+	}
+}
+
+func TestNew_MissingConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		new  func()
+	}{
+		{"New", func() { New(context.Background(), nil) }},
+		{"UnaryServerInterceptor", func() { UnaryServerInterceptor(context.Background(), nil) }},
+		{"StreamServerInterceptor", func() { StreamServerInterceptor(context.Background(), nil) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s() did not panic without an IAMConfig or Keyfunc", tt.name)
+				}
+			}()
+			tt.new()
+		})
+	}
+
+	// A Keyfunc makes the config optional
+	New(context.Background(), nil, WithKeyfunc(func(*jwt.Token) (interface{}, error) { return nil, nil }))
+}
@@ -0,0 +1,76 @@
+package jwtmiddleware
+
+import (
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/golang-jwt/jwt/v5/request"
+)
+
+// Option configures the middleware returned by New.
+type Option func(*options)
+
+type options struct {
+	audience            string
+	extractor           request.Extractor
+	claims              func() jwt.Claims
+	keyFunc             jwt.Keyfunc
+	errorHandler        ErrorHandler
+	issuers             []string
+	credentialsOptional bool
+}
+
+// WithAudience will validate the Audience claim of tokens to the one provided, https:// + request.Host is used if
+// blank or not set.
+func WithAudience(audience string) Option {
+	return func(o *options) {
+		o.audience = audience
+	}
+}
+
+// WithExtractors will look for tokens using the provided extractors, in order, using the first token found. The token
+// is expected as a Bearer token in the Authorization header by default. See CookieExtractor, QueryExtractor, and the
+// request package's HeaderExtractor and BearerExtractor.
+func WithExtractors(extractors ...request.Extractor) Option {
+	return func(o *options) {
+		o.extractor = request.MultiExtractor(extractors)
+	}
+}
+
+// WithClaims will parse tokens into the claims returned by the provided function, which must return a new value for
+// each call. *jwt.RegisteredClaims are used by default.
+func WithClaims(claims func() jwt.Claims) Option {
+	return func(o *options) {
+		o.claims = claims
+	}
+}
+
+// WithIssuers will only accept tokens with an Issuer claim equal to one of the provided issuers. Only the
+// ServiceAccount of the IAMConfig is accepted by default.
+func WithIssuers(issuers ...string) Option {
+	return func(o *options) {
+		o.issuers = issuers
+	}
+}
+
+// WithKeyfunc will verify tokens with the provided jwt.Keyfunc in place of the IAMConfig's certificates, such as
+// gcpjwt.Verifier's Keyfunc to accept tokens from several issuers.
+func WithKeyfunc(keyFunc jwt.Keyfunc) Option {
+	return func(o *options) {
+		o.keyFunc = keyFunc
+	}
+}
+
+// WithErrorHandler will respond to requests without a valid token with the provided ErrorHandler. TextErrorHandler is
+// used by default, ProblemJSONErrorHandler is also provided.
+func WithErrorHandler(handler ErrorHandler) Option {
+	return func(o *options) {
+		o.errorHandler = handler
+	}
+}
+
+// WithCredentialsOptional will let requests without a token through, requests with an invalid token are still
+// rejected.
+func WithCredentialsOptional() Option {
+	return func(o *options) {
+		o.credentialsOptional = true
+	}
+}
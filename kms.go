@@ -9,9 +9,8 @@ import (
 	"fmt"
 	"math/big"
 
-	kms "cloud.google.com/go/kms/apiv1"
-	"github.com/dgrijalva/jwt-go"
-	kmspb "google.golang.org/genproto/googleapis/cloud/kms/v1"
+	kmspb "cloud.google.com/go/kms/apiv1/kmspb"
+	"github.com/golang-jwt/jwt/v5"
 )
 
 // SigningMethodKMS implements the jwt.SiginingMethod interface for Google's Cloud KMS service
@@ -39,6 +38,18 @@ var (
 	// SigningMethodKMSES384 leverages Cloud KMS for the ES256 algorithm, use with:
 	// EC_SIGN_P384_SHA384
 	SigningMethodKMSES384 *SigningMethodKMS
+	// SigningMethodKMSRS512 leverages Cloud KMS for RS512 algorithms, use with:
+	// RSA_SIGN_PKCS1_4096_SHA512
+	SigningMethodKMSRS512 *SigningMethodKMS
+	// SigningMethodKMSPS512 leverages Cloud KMS for PS512 algorithms, use with:
+	// RSA_SIGN_PSS_4096_SHA512
+	SigningMethodKMSPS512 *SigningMethodKMS
+	// SigningMethodKMSES256K leverages Cloud KMS for the ES256K algorithm, use with:
+	// EC_SIGN_SECP256K1_SHA256
+	SigningMethodKMSES256K *SigningMethodKMS
+	// SigningMethodKMSEdDSA leverages Cloud KMS for the EdDSA algorithm, use with:
+	// EC_SIGN_ED25519
+	SigningMethodKMSEdDSA *SigningMethodKMS
 )
 
 func init() {
@@ -81,6 +92,46 @@ func init() {
 	jwt.RegisterSigningMethod(SigningMethodKMSES384.Alg(), func() jwt.SigningMethod {
 		return SigningMethodKMSES384
 	})
+
+	// RS512
+	SigningMethodKMSRS512 = &SigningMethodKMS{
+		"KMSRS512",
+		jwt.SigningMethodRS512,
+		crypto.SHA512,
+	}
+	jwt.RegisterSigningMethod(SigningMethodKMSRS512.Alg(), func() jwt.SigningMethod {
+		return SigningMethodKMSRS512
+	})
+
+	// PS512
+	SigningMethodKMSPS512 = &SigningMethodKMS{
+		"KMSPS512",
+		jwt.SigningMethodPS512,
+		crypto.SHA512,
+	}
+	jwt.RegisterSigningMethod(SigningMethodKMSPS512.Alg(), func() jwt.SigningMethod {
+		return SigningMethodKMSPS512
+	})
+
+	// ES256K
+	SigningMethodKMSES256K = &SigningMethodKMS{
+		"KMSES256K",
+		SigningMethodES256K,
+		crypto.SHA256,
+	}
+	jwt.RegisterSigningMethod(SigningMethodKMSES256K.Alg(), func() jwt.SigningMethod {
+		return SigningMethodKMSES256K
+	})
+
+	// EdDSA signs the data itself rather than a digest
+	SigningMethodKMSEdDSA = &SigningMethodKMS{
+		"KMSEdDSA",
+		jwt.SigningMethodEdDSA,
+		0,
+	}
+	jwt.RegisterSigningMethod(SigningMethodKMSEdDSA.Alg(), func() jwt.SigningMethod {
+		return SigningMethodKMSEdDSA
+	})
 }
 
 // Alg will return the JWT header algorithm identifier this method is configured for.
@@ -96,7 +147,8 @@ func (s *SigningMethodKMS) Override() {
 	})
 }
 
-// Hash will return the crypto.Hash used for this signing method
+// Hash will return the crypto.Hash used for this signing method, or 0 if the data is signed without hashing it first
+// as is the case for EdDSA.
 func (s *SigningMethodKMS) Hash() crypto.Hash {
 	return s.hasher
 }
@@ -104,7 +156,7 @@ func (s *SigningMethodKMS) Hash() crypto.Hash {
 // Sign implements the Sign method from jwt.SigningMethod. For this signing method, a valid context.Context must be
 // passed as the key containing a KMSConfig value.
 // https://cloud.google.com/kms/docs/create-validate-signatures#kms-howto-sign-go
-func (s *SigningMethodKMS) Sign(signingString string, key interface{}) (string, error) {
+func (s *SigningMethodKMS) Sign(signingString string, key interface{}) ([]byte, error) {
 	var ctx context.Context
 
 	// check to make sure the key is a context.Context
@@ -112,95 +164,87 @@ func (s *SigningMethodKMS) Sign(signingString string, key interface{}) (string,
 	case context.Context:
 		ctx = k
 	default:
-		return "", jwt.ErrInvalidKey
+		return nil, jwt.ErrInvalidKey
 	}
 
 	// Get the KMSConfig from the context
 	config, ok := KMSFromContext(ctx)
 	if !ok {
-		return "", ErrMissingConfig
+		return nil, ErrMissingConfig
 	}
 
-	if !s.hasher.Available() {
-		return "", jwt.ErrHashUnavailable
-	}
+	data := []byte(signingString)
+	if s.hasher != 0 {
+		if !s.hasher.Available() {
+			return nil, jwt.ErrHashUnavailable
+		}
 
-	digest := s.hasher.New()
-	_, err := digest.Write([]byte(signingString))
-	if err != nil {
-		return "", err
+		digest := s.hasher.New()
+		_, err := digest.Write(data)
+		if err != nil {
+			return nil, err
+		}
+		data = digest.Sum(nil)
 	}
 
-	asymmetricSignRequest := &kmspb.AsymmetricSignRequest{}
-	switch s.hasher {
-	case crypto.SHA256:
-		asymmetricSignRequest.Digest = &kmspb.Digest{
-			Digest: &kmspb.Digest_Sha256{
-				Sha256: digest.Sum(nil),
-			},
+	// Pick the key version matching the token's kid when signing with a CryptoKey
+	var kid string
+	if isCryptoKeyPath(config.KeyPath) {
+		var err error
+		if kid, err = headerKeyID(signingString); err != nil {
+			return nil, fmt.Errorf("gcpjwt: could not decode token header: %v", err)
 		}
+	}
+	name, err := config.keyVersionName(ctx, kid)
+	if err != nil {
+		return nil, err
+	}
 
-	case crypto.SHA384:
-		asymmetricSignRequest.Digest = &kmspb.Digest{
-			Digest: &kmspb.Digest_Sha384{
-				Sha384: digest.Sum(nil),
-			},
-		}
+	// Do the call
+	signature, err := signKMS(ctx, config, name, s.hasher, data)
+	if err != nil {
+		return nil, err
 	}
 
 	// ECDSA Signatures from Cloud KMS come ASN1 encoded, which isn't to spec
 	// https://tools.ietf.org/html/rfc7518#section-3.4
-	var ecdsaMethod *jwt.SigningMethodECDSA
-	if method, ok := s.override.(*jwt.SigningMethodECDSA); ok {
-		ecdsaMethod = method
+	switch method := s.override.(type) {
+	case *jwt.SigningMethodECDSA:
+		return ecdsaRawSignature(signature, method.CurveBits)
+	case *SigningMethodSecp256k1:
+		return ecdsaRawSignature(signature, 256)
 	}
 
-	// Do the call
-	return signKMS(ctx, config, asymmetricSignRequest, ecdsaMethod)
+	return signature, nil
 }
 
 // KMSVerfiyKeyfunc is a helper meant that returns a jwt.Keyfunc. It will handle pulling and selecting the certificates
 // to verify signatures with, caching the public key in memory. It is not valid to modify the KMSConfig provided after
 // calling this function, you must call this again if changes to the config's KeyPath are made. Note that the public key
-// is retrieved when creating the key func and returned for each call to the returned jwt.Keyfunc.
+// is retrieved when creating the key func and returned for each call to the returned jwt.Keyfunc. If the KeyPath
+// names a CryptoKey, this is the same as calling KMSCryptoKeyVerfiyKeyfunc.
 // https://cloud.google.com/kms/docs/retrieve-public-key#kms-howto-retrieve-public-key-go
 func KMSVerfiyKeyfunc(ctx context.Context, config *KMSConfig) (jwt.Keyfunc, error) {
-	// The Public Key is static for the key version, so grab it now and re-use it as needed
-	var publicKey interface{}
-	keyVersion := config.KeyID()
-	client := config.KMSClient
-	if client == nil {
-		c, err := kms.NewKeyManagementClient(ctx)
-		if err != nil {
-			return nil, err
-		}
-		client = c
+	if isCryptoKeyPath(config.KeyPath) {
+		return KMSCryptoKeyVerfiyKeyfunc(ctx, config)
 	}
 
-	response, err := client.GetPublicKey(ctx, &kmspb.GetPublicKeyRequest{Name: config.KeyPath})
+	// The Public Key is static for the key version, so grab it now and re-use it as needed
+	keyVersion := config.KeyID()
+	publicKey, _, err := getKMSPublicKey(ctx, config)
 	if err != nil {
 		return nil, err
 	}
 
-	keyBytes := []byte(response.Pem)
-	block, _ := pem.Decode(keyBytes)
-	if block == nil {
-		return nil, fmt.Errorf("gcpjwt: could not parse certificate from response")
-	}
-	publicKey, err = x509.ParsePKIXPublicKey(block.Bytes)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse public key: %+v", err)
-	}
-
 	return func(token *jwt.Token) (interface{}, error) {
 		// Make sure we have the proper header alg
 		if _, ok := token.Method.(*SigningMethodKMS); !ok {
-			return nil, fmt.Errorf("gcpjwt: unexpected signing method: %v", token.Header["alg"])
+			return nil, fmt.Errorf("%w: %v", ErrUnexpectedSigningMethod, token.Header["alg"])
 		}
 
 		if kid, ok := token.Header["kid"].(string); ok {
 			if kid != keyVersion {
-				return nil, fmt.Errorf("gcpjwt: unknown kid `%s` found in header", kid)
+				return nil, &KeyNotFoundError{KeyID: kid, Issuer: config.KeyPath}
 			}
 		}
 
@@ -211,52 +255,180 @@ func KMSVerfiyKeyfunc(ctx context.Context, config *KMSConfig) (jwt.Keyfunc, erro
 // Verify does a pass-thru to the appropriate jwt.SigningMethod for this signing algorithm and expects the same key
 // https://cloud.google.com/kms/docs/create-validate-signatures#validate_ec_signature
 // https://cloud.google.com/kms/docs/create-validate-signatures#validate_rsa_signature
-func (s *SigningMethodKMS) Verify(signingString, signature string, key interface{}) error {
+func (s *SigningMethodKMS) Verify(signingString string, signature []byte, key interface{}) error {
 	return s.override.Verify(signingString, signature, key)
 }
 
-func signKMS(ctx context.Context, config *KMSConfig, request *kmspb.AsymmetricSignRequest, ecdsaMethod *jwt.SigningMethodECDSA) (string, error) {
-	client := config.KMSClient
-	if client == nil {
-		c, err := kms.NewKeyManagementClient(ctx)
+// KMSSigningMethod will return the signing method to use with the algorithm of the configured key version, or of the
+// newest enabled version if KeyPath names a CryptoKey, as reported by the GetPublicKey API.
+func KMSSigningMethod(ctx context.Context, config *KMSConfig) (*SigningMethodKMS, error) {
+	name, err := config.keyVersionName(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+
+	_, algorithm, err := fetchKMSPublicKey(ctx, config, name)
+	if err != nil {
+		return nil, err
+	}
+
+	method := kmsSigningMethodForAlgorithm(algorithm)
+	if method == nil {
+		return nil, fmt.Errorf("gcpjwt: unsupported Cloud KMS key algorithm: %v", algorithm)
+	}
+
+	return method, nil
+}
+
+// kmsSigningMethodForAlgorithm will return the signing method to use with the algorithm, or nil if not supported
+func kmsSigningMethodForAlgorithm(algorithm kmspb.CryptoKeyVersion_CryptoKeyVersionAlgorithm) *SigningMethodKMS {
+	switch algorithm {
+	case kmspb.CryptoKeyVersion_RSA_SIGN_PKCS1_2048_SHA256,
+		kmspb.CryptoKeyVersion_RSA_SIGN_PKCS1_3072_SHA256,
+		kmspb.CryptoKeyVersion_RSA_SIGN_PKCS1_4096_SHA256:
+		return SigningMethodKMSRS256
+	case kmspb.CryptoKeyVersion_RSA_SIGN_PKCS1_4096_SHA512:
+		return SigningMethodKMSRS512
+	case kmspb.CryptoKeyVersion_RSA_SIGN_PSS_2048_SHA256,
+		kmspb.CryptoKeyVersion_RSA_SIGN_PSS_3072_SHA256,
+		kmspb.CryptoKeyVersion_RSA_SIGN_PSS_4096_SHA256:
+		return SigningMethodKMSPS256
+	case kmspb.CryptoKeyVersion_RSA_SIGN_PSS_4096_SHA512:
+		return SigningMethodKMSPS512
+	case kmspb.CryptoKeyVersion_EC_SIGN_P256_SHA256:
+		return SigningMethodKMSES256
+	case kmspb.CryptoKeyVersion_EC_SIGN_P384_SHA384:
+		return SigningMethodKMSES384
+	case kmspb.CryptoKeyVersion_EC_SIGN_SECP256K1_SHA256:
+		return SigningMethodKMSES256K
+	case kmspb.CryptoKeyVersion_EC_SIGN_ED25519:
+		return SigningMethodKMSEdDSA
+	default:
+		return nil
+	}
+}
+
+// getKMSPublicKey will retrieve and parse the public key for the configured key version along with its algorithm
+func getKMSPublicKey(ctx context.Context, config *KMSConfig) (crypto.PublicKey, kmspb.CryptoKeyVersion_CryptoKeyVersionAlgorithm, error) {
+	return fetchKMSPublicKey(ctx, config, config.KeyPath)
+}
+
+// fetchKMSPublicKey will retrieve and parse the public key for the named key version along with its algorithm
+func fetchKMSPublicKey(ctx context.Context, config *KMSConfig, name string) (crypto.PublicKey, kmspb.CryptoKeyVersion_CryptoKeyVersionAlgorithm, error) {
+	client, err := kmsClient(ctx, config)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	request := &kmspb.GetPublicKeyRequest{Name: name}
+	var response *kmspb.PublicKey
+	err = config.RetryPolicy.do(ctx, func() error {
+		response, err = client.GetPublicKey(ctx, request, kmsCallOptions...)
 		if err != nil {
-			return "", err
+			return err
 		}
-		client = c
+		return checkPublicKeyResponse(request, response)
+	})
+	if err != nil {
+		return nil, 0, &KeySourceError{Source: name, Err: err}
 	}
 
-	// Add key name to request
-	request.Name = config.KeyPath
+	keyBytes := []byte(response.Pem)
+	block, _ := pem.Decode(keyBytes)
+	if block == nil {
+		return nil, 0, fmt.Errorf("gcpjwt: could not parse certificate from response")
+	}
+	var publicKey crypto.PublicKey
+	if response.Algorithm == kmspb.CryptoKeyVersion_EC_SIGN_SECP256K1_SHA256 {
+		publicKey, err = parseSecp256k1PublicKey(block.Bytes)
+	} else {
+		publicKey, err = x509.ParsePKIXPublicKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to parse public key: %+v", err)
+	}
 
-	// Do the call
-	signResp, err := client.AsymmetricSign(ctx, request)
+	return publicKey, response.Algorithm, nil
+}
+
+// signKMS will sign the digest, created with the provided hash, with the named key version. If the hash is 0, the
+// digest is treated as the data to sign as is required for Ed25519 keys. ECDSA signatures are returned ASN1 encoded.
+// CRC32C checksums are used to verify the integrity of the request and response, an *IntegrityError is returned if
+// they fail.
+func signKMS(ctx context.Context, config *KMSConfig, name string, hash crypto.Hash, digest []byte) ([]byte, error) {
+	client, err := kmsClient(ctx, config)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	// If this was signed with the ECDSA algorithm, update the signature to keep it in spec
-	if ecdsaMethod != nil {
-		var parsedSig struct{ R, S *big.Int }
-		_, err = asn1.Unmarshal(signResp.Signature, &parsedSig)
-		if err != nil {
-			return "", fmt.Errorf("gcpjwt: failed to parse ecdsa signature bytes: %+v", err)
+	request := &kmspb.AsymmetricSignRequest{
+		Name: name,
+	}
+	switch hash {
+	case 0:
+		request.Data = digest
+		request.DataCrc32C = crc32c(digest)
+	case crypto.SHA256:
+		request.Digest = &kmspb.Digest{
+			Digest: &kmspb.Digest_Sha256{
+				Sha256: digest,
+			},
+		}
+	case crypto.SHA384:
+		request.Digest = &kmspb.Digest{
+			Digest: &kmspb.Digest_Sha384{
+				Sha384: digest,
+			},
+		}
+	case crypto.SHA512:
+		request.Digest = &kmspb.Digest{
+			Digest: &kmspb.Digest_Sha512{
+				Sha512: digest,
+			},
 		}
+	default:
+		return nil, fmt.Errorf("gcpjwt: unsupported hash function for Cloud KMS: %v", hash)
+	}
+	if request.Digest != nil {
+		request.DigestCrc32C = crc32c(digest)
+	}
 
-		keyBytes := ecdsaMethod.CurveBits / 8
-		if ecdsaMethod.CurveBits%8 > 0 {
-			keyBytes++
+	// Do the call
+	var signResp *kmspb.AsymmetricSignResponse
+	err = config.RetryPolicy.do(ctx, func() error {
+		signResp, err = client.AsymmetricSign(ctx, request, kmsCallOptions...)
+		if err != nil {
+			return err
 		}
+		return checkAsymmetricSignResponse(request, signResp)
+	})
+	if err != nil {
+		return nil, &SigningError{Name: name, Err: err}
+	}
 
-		rBytes := parsedSig.R.Bytes()
-		rBytesPadded := make([]byte, keyBytes)
-		copy(rBytesPadded[keyBytes-len(rBytes):], rBytes)
+	return signResp.Signature, nil
+}
 
-		sBytes := parsedSig.S.Bytes()
-		sBytesPadded := make([]byte, keyBytes)
-		copy(sBytesPadded[keyBytes-len(sBytes):], sBytes)
+// ecdsaRawSignature will convert an ASN1 encoded ECDSA signature to the R || S format required for JWTs
+func ecdsaRawSignature(signature []byte, curveBits int) ([]byte, error) {
+	var parsedSig struct{ R, S *big.Int }
+	_, err := asn1.Unmarshal(signature, &parsedSig)
+	if err != nil {
+		return nil, fmt.Errorf("gcpjwt: failed to parse ecdsa signature bytes: %+v", err)
+	}
 
-		signResp.Signature = append(rBytesPadded, sBytesPadded...)
+	keyBytes := curveBits / 8
+	if curveBits%8 > 0 {
+		keyBytes++
 	}
 
-	return jwt.EncodeSegment(signResp.Signature), nil
+	rBytes := parsedSig.R.Bytes()
+	rBytesPadded := make([]byte, keyBytes)
+	copy(rBytesPadded[keyBytes-len(rBytes):], rBytes)
+
+	sBytes := parsedSig.S.Bytes()
+	sBytesPadded := make([]byte, keyBytes)
+	copy(sBytesPadded[keyBytes-len(sBytes):], sBytes)
+
+	return append(rBytesPadded, sBytesPadded...), nil
 }
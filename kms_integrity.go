@@ -0,0 +1,74 @@
+package gcpjwt
+
+import (
+	"hash/crc32"
+
+	kmspb "cloud.google.com/go/kms/apiv1/kmspb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+// crc32c will return the CRC32C checksum of data as expected by the Cloud KMS API
+func crc32c(data []byte) *wrapperspb.Int64Value {
+	return wrapperspb.Int64(int64(crc32.Checksum(data, crc32cTable)))
+}
+
+// crc32cMatches will return true if the checksum provided by Cloud KMS matches the data
+func crc32cMatches(data []byte, checksum *wrapperspb.Int64Value) bool {
+	return checksum != nil && checksum.GetValue() == crc32c(data).GetValue()
+}
+
+// checkAsymmetricSignResponse will verify the integrity of an AsymmetricSign call
+func checkAsymmetricSignResponse(request *kmspb.AsymmetricSignRequest, response *kmspb.AsymmetricSignResponse) error {
+	switch {
+	case response.Name != request.Name:
+		return &IntegrityError{Name: request.Name, Check: "name"}
+	case request.Digest != nil && !response.VerifiedDigestCrc32C:
+		return &IntegrityError{Name: request.Name, Check: "verified_digest_crc32c"}
+	case request.Data != nil && !response.VerifiedDataCrc32C:
+		return &IntegrityError{Name: request.Name, Check: "verified_data_crc32c"}
+	case !crc32cMatches(response.Signature, response.SignatureCrc32C):
+		return &IntegrityError{Name: request.Name, Check: "signature_crc32c"}
+	}
+	return nil
+}
+
+// checkPublicKeyResponse will verify the integrity of a GetPublicKey call
+func checkPublicKeyResponse(request *kmspb.GetPublicKeyRequest, response *kmspb.PublicKey) error {
+	switch {
+	case response.Name != request.Name:
+		return &IntegrityError{Name: request.Name, Check: "name"}
+	case !crc32cMatches([]byte(response.Pem), response.PemCrc32C):
+		return &IntegrityError{Name: request.Name, Check: "pem_crc32c"}
+	}
+	return nil
+}
+
+// checkMacSignResponse will verify the integrity of a MacSign call
+func checkMacSignResponse(request *kmspb.MacSignRequest, response *kmspb.MacSignResponse) error {
+	switch {
+	case response.Name != request.Name:
+		return &IntegrityError{Name: request.Name, Check: "name"}
+	case !response.VerifiedDataCrc32C:
+		return &IntegrityError{Name: request.Name, Check: "verified_data_crc32c"}
+	case !crc32cMatches(response.Mac, response.MacCrc32C):
+		return &IntegrityError{Name: request.Name, Check: "mac_crc32c"}
+	}
+	return nil
+}
+
+// checkMacVerifyResponse will verify the integrity of a MacVerify call
+func checkMacVerifyResponse(request *kmspb.MacVerifyRequest, response *kmspb.MacVerifyResponse) error {
+	switch {
+	case response.Name != request.Name:
+		return &IntegrityError{Name: request.Name, Check: "name"}
+	case !response.VerifiedDataCrc32C:
+		return &IntegrityError{Name: request.Name, Check: "verified_data_crc32c"}
+	case !response.VerifiedMacCrc32C:
+		return &IntegrityError{Name: request.Name, Check: "verified_mac_crc32c"}
+	case response.VerifiedSuccessIntegrity != response.Success:
+		return &IntegrityError{Name: request.Name, Check: "verified_success_integrity"}
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+package gcpjwt
+
+import (
+	"errors"
+	"testing"
+
+	kmspb "cloud.google.com/go/kms/apiv1/kmspb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func Test_crc32c(t *testing.T) {
+	// Known CRC32C (Castagnoli) check value
+	if got := crc32c([]byte("123456789")).GetValue(); got != 0xe3069283 {
+		t.Errorf("crc32c() = %x, want %x", got, 0xe3069283)
+	}
+	if crc32cMatches([]byte("data"), nil) {
+		t.Errorf("crc32cMatches() expected false for missing checksum")
+	}
+}
+
+func Test_checkAsymmetricSignResponse(t *testing.T) {
+	name := "projects/p/locations/global/keyRings/r/cryptoKeys/k/cryptoKeyVersions/1"
+	signature := []byte("signature")
+	digestRequest := &kmspb.AsymmetricSignRequest{
+		Name:   name,
+		Digest: &kmspb.Digest{Digest: &kmspb.Digest_Sha256{Sha256: []byte("digest")}},
+	}
+	dataRequest := &kmspb.AsymmetricSignRequest{
+		Name: name,
+		Data: []byte("data"),
+	}
+	tests := []struct {
+		name      string
+		request   *kmspb.AsymmetricSignRequest
+		response  *kmspb.AsymmetricSignResponse
+		wantCheck string
+	}{
+		{
+			"ValidDigest",
+			digestRequest,
+			&kmspb.AsymmetricSignResponse{Name: name, Signature: signature, SignatureCrc32C: crc32c(signature), VerifiedDigestCrc32C: true},
+			"",
+		},
+		{
+			"ValidData",
+			dataRequest,
+			&kmspb.AsymmetricSignResponse{Name: name, Signature: signature, SignatureCrc32C: crc32c(signature), VerifiedDataCrc32C: true},
+			"",
+		},
+		{
+			"WrongName",
+			digestRequest,
+			&kmspb.AsymmetricSignResponse{Name: "other", Signature: signature, SignatureCrc32C: crc32c(signature), VerifiedDigestCrc32C: true},
+			"name",
+		},
+		{
+			"DigestNotVerified",
+			digestRequest,
+			&kmspb.AsymmetricSignResponse{Name: name, Signature: signature, SignatureCrc32C: crc32c(signature)},
+			"verified_digest_crc32c",
+		},
+		{
+			"DataNotVerified",
+			dataRequest,
+			&kmspb.AsymmetricSignResponse{Name: name, Signature: signature, SignatureCrc32C: crc32c(signature)},
+			"verified_data_crc32c",
+		},
+		{
+			"CorruptSignature",
+			digestRequest,
+			&kmspb.AsymmetricSignResponse{Name: name, Signature: []byte("corrupt"), SignatureCrc32C: crc32c(signature), VerifiedDigestCrc32C: true},
+			"signature_crc32c",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertIntegrityCheck(t, checkAsymmetricSignResponse(tt.request, tt.response), tt.wantCheck)
+		})
+	}
+}
+
+func Test_checkPublicKeyResponse(t *testing.T) {
+	name := "projects/p/locations/global/keyRings/r/cryptoKeys/k/cryptoKeyVersions/1"
+	pem := "-----BEGIN PUBLIC KEY-----"
+	request := &kmspb.GetPublicKeyRequest{Name: name}
+	tests := []struct {
+		name      string
+		response  *kmspb.PublicKey
+		wantCheck string
+	}{
+		{
+			"Valid",
+			&kmspb.PublicKey{Name: name, Pem: pem, PemCrc32C: crc32c([]byte(pem))},
+			"",
+		},
+		{
+			"WrongName",
+			&kmspb.PublicKey{Name: "other", Pem: pem, PemCrc32C: crc32c([]byte(pem))},
+			"name",
+		},
+		{
+			"CorruptPem",
+			&kmspb.PublicKey{Name: name, Pem: pem + "corrupt", PemCrc32C: crc32c([]byte(pem))},
+			"pem_crc32c",
+		},
+		{
+			"MissingChecksum",
+			&kmspb.PublicKey{Name: name, Pem: pem},
+			"pem_crc32c",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertIntegrityCheck(t, checkPublicKeyResponse(request, tt.response), tt.wantCheck)
+		})
+	}
+}
+
+func Test_checkMacResponses(t *testing.T) {
+	name := "projects/p/locations/global/keyRings/r/cryptoKeys/k/cryptoKeyVersions/1"
+	mac := []byte("mac")
+	signRequest := &kmspb.MacSignRequest{Name: name}
+	verifyRequest := &kmspb.MacVerifyRequest{Name: name}
+
+	signTests := []struct {
+		name      string
+		response  *kmspb.MacSignResponse
+		wantCheck string
+	}{
+		{"Valid", &kmspb.MacSignResponse{Name: name, Mac: mac, MacCrc32C: crc32c(mac), VerifiedDataCrc32C: true}, ""},
+		{"WrongName", &kmspb.MacSignResponse{Name: "other", Mac: mac, MacCrc32C: crc32c(mac), VerifiedDataCrc32C: true}, "name"},
+		{"DataNotVerified", &kmspb.MacSignResponse{Name: name, Mac: mac, MacCrc32C: crc32c(mac)}, "verified_data_crc32c"},
+		{"CorruptMac", &kmspb.MacSignResponse{Name: name, Mac: mac, MacCrc32C: wrapperspb.Int64(1), VerifiedDataCrc32C: true}, "mac_crc32c"},
+	}
+	for _, tt := range signTests {
+		t.Run("Sign"+tt.name, func(t *testing.T) {
+			assertIntegrityCheck(t, checkMacSignResponse(signRequest, tt.response), tt.wantCheck)
+		})
+	}
+
+	verifyTests := []struct {
+		name      string
+		response  *kmspb.MacVerifyResponse
+		wantCheck string
+	}{
+		{"Valid", &kmspb.MacVerifyResponse{Name: name, Success: true, VerifiedDataCrc32C: true, VerifiedMacCrc32C: true, VerifiedSuccessIntegrity: true}, ""},
+		{"ValidFailure", &kmspb.MacVerifyResponse{Name: name, VerifiedDataCrc32C: true, VerifiedMacCrc32C: true}, ""},
+		{"WrongName", &kmspb.MacVerifyResponse{Name: "other", Success: true, VerifiedDataCrc32C: true, VerifiedMacCrc32C: true, VerifiedSuccessIntegrity: true}, "name"},
+		{"DataNotVerified", &kmspb.MacVerifyResponse{Name: name, Success: true, VerifiedMacCrc32C: true, VerifiedSuccessIntegrity: true}, "verified_data_crc32c"},
+		{"MacNotVerified", &kmspb.MacVerifyResponse{Name: name, Success: true, VerifiedDataCrc32C: true, VerifiedSuccessIntegrity: true}, "verified_mac_crc32c"},
+		{"SuccessMismatch", &kmspb.MacVerifyResponse{Name: name, Success: true, VerifiedDataCrc32C: true, VerifiedMacCrc32C: true}, "verified_success_integrity"},
+	}
+	for _, tt := range verifyTests {
+		t.Run("Verify"+tt.name, func(t *testing.T) {
+			assertIntegrityCheck(t, checkMacVerifyResponse(verifyRequest, tt.response), tt.wantCheck)
+		})
+	}
+}
+
+func assertIntegrityCheck(t *testing.T, err error, wantCheck string) {
+	t.Helper()
+	if wantCheck == "" {
+		if err != nil {
+			t.Errorf("unexpected error = %v", err)
+		}
+		return
+	}
+
+	var integrityErr *IntegrityError
+	if !errors.As(err, &integrityErr) {
+		t.Errorf("expected *IntegrityError, got %v", err)
+		return
+	}
+	if integrityErr.Check != wantCheck {
+		t.Errorf("IntegrityError.Check = %s, want %s", integrityErr.Check, wantCheck)
+	}
+}
@@ -0,0 +1,331 @@
+package gcpjwt
+
+import (
+	"context"
+	"crypto"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	kmspb "cloud.google.com/go/kms/apiv1/kmspb"
+	"github.com/golang-jwt/jwt/v5"
+	"google.golang.org/api/iterator"
+)
+
+// kmsVersionsFetcher retrieves the public keys of the enabled versions of a CryptoKey keyed by their key id. Public
+// keys already known are provided so they do not need to be retrieved again.
+type kmsVersionsFetcher func(ctx context.Context, config *KMSConfig, known map[string]crypto.PublicKey) (map[string]crypto.PublicKey, error)
+
+// kmsKeyVersions holds the public keys of the enabled versions of a CryptoKey
+type kmsKeyVersions struct {
+	config *KMSConfig
+	fetch  kmsVersionsFetcher
+
+	mu          sync.Mutex
+	keys        map[string]crypto.PublicKey
+	lastRefresh time.Time
+}
+
+// KMSCryptoKeyVerfiyKeyfunc is a helper meant that returns a jwt.Keyfunc for tokens signed by any enabled version of
+// a Cloud KMS CryptoKey, allowing keys to be rotated without failing verification of tokens signed by a previous
+// version. The KMSConfig's KeyPath must name the CryptoKey in the format of:
+// "projects/*/locations/*/keyRings/*/cryptoKeys/*"
+// The public keys of all enabled versions are retrieved when creating the key func and keyed by the same kid as
+// KMSConfig.KeyID() would return for the version's path. The versions are rediscovered every
+// KMSConfig.KeyVersionRefreshInterval, or when a token references an unknown kid at most once every
+// DefaultMinRefreshInterval.
+// https://cloud.google.com/kms/docs/rotate-key
+func KMSCryptoKeyVerfiyKeyfunc(ctx context.Context, config *KMSConfig) (jwt.Keyfunc, error) {
+	versions := &kmsKeyVersions{
+		config: config,
+		fetch:  fetchKMSKeyVersions,
+	}
+	if _, err := versions.publicKeys(ctx, "", false); err != nil {
+		return nil, err
+	}
+
+	return versions.keyfunc(ctx), nil
+}
+
+func (k *kmsKeyVersions) keyfunc(ctx context.Context) jwt.Keyfunc {
+	return func(token *jwt.Token) (interface{}, error) {
+		// Make sure we have the proper header alg
+		if _, ok := token.Method.(*SigningMethodKMS); !ok {
+			return nil, fmt.Errorf("%w: %v", ErrUnexpectedSigningMethod, token.Header["alg"])
+		}
+		method := standardMethod(token.Method)
+
+		kid, hasKid := token.Header["kid"].(string)
+		keys, err := k.publicKeys(ctx, kid, hasKid)
+		if err != nil {
+			return nil, err
+		}
+
+		if hasKid {
+			key, found := keys[kid]
+			if !found || !keyMatchesMethod(key, method) {
+				return nil, &KeyNotFoundError{KeyID: kid, Issuer: k.config.KeyPath}
+			}
+			return key, nil
+		}
+
+		// Without a kid, try every enabled version that can verify this signing method
+		var keySet jwt.VerificationKeySet
+		for _, key := range keys {
+			if keyMatchesMethod(key, method) {
+				keySet.Keys = append(keySet.Keys, key)
+			}
+		}
+		if len(keySet.Keys) == 0 {
+			return nil, &KeyNotFoundError{Issuer: k.config.KeyPath}
+		}
+
+		return keySet, nil
+	}
+}
+
+// publicKeys will return the public keys of the enabled versions, rediscovering them if the refresh interval has
+// elapsed or if lookup is true and kid is not known. Previously discovered keys are returned if rediscovering fails.
+func (k *kmsKeyVersions) publicKeys(ctx context.Context, kid string, lookup bool) (map[string]crypto.PublicKey, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	sinceRefresh := time.Since(k.lastRefresh)
+	_, known := k.keys[kid]
+	refresh := k.keys == nil ||
+		sinceRefresh >= k.config.keyVersionRefreshInterval() ||
+		(lookup && !known && sinceRefresh >= DefaultMinRefreshInterval)
+	if !refresh {
+		return k.keys, nil
+	}
+
+	keys, err := k.fetch(ctx, k.config, k.keys)
+	k.lastRefresh = time.Now()
+	if err != nil {
+		if k.keys == nil {
+			return nil, err
+		}
+		return k.keys, nil
+	}
+	k.keys = keys
+
+	return k.keys, nil
+}
+
+// fetchKMSKeyVersions will list the enabled asymmetric signing versions of the configured CryptoKey and retrieve
+// their public keys
+func fetchKMSKeyVersions(ctx context.Context, config *KMSConfig, known map[string]crypto.PublicKey) (map[string]crypto.PublicKey, error) {
+	versions, err := listKMSKeyVersions(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]crypto.PublicKey)
+	for _, version := range versions {
+		kid := kmsKeyID(version.Name)
+		if key, ok := known[kid]; ok {
+			// The public key of a version never changes
+			keys[kid] = key
+			continue
+		}
+
+		if !isAsymmetricSigningAlgorithm(version.Algorithm) {
+			continue
+		}
+
+		key, _, err := fetchKMSPublicKey(ctx, config, version.Name)
+		if err != nil {
+			return nil, err
+		}
+		keys[kid] = key
+	}
+
+	return keys, nil
+}
+
+// listKMSKeyVersions will list the enabled asymmetric and MAC signing versions of the configured CryptoKey
+func listKMSKeyVersions(ctx context.Context, config *KMSConfig) ([]*kmspb.CryptoKeyVersion, error) {
+	client, err := kmsClient(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []*kmspb.CryptoKeyVersion
+	err = config.RetryPolicy.do(ctx, func() error {
+		versions = nil
+		it := client.ListCryptoKeyVersions(ctx, &kmspb.ListCryptoKeyVersionsRequest{
+			Parent: config.KeyPath,
+			Filter: "state=ENABLED",
+		}, kmsCallOptions...)
+		for {
+			version, err := it.Next()
+			if err == iterator.Done {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if version.State == kmspb.CryptoKeyVersion_ENABLED &&
+				(isAsymmetricSigningAlgorithm(version.Algorithm) || isMacSigningAlgorithm(version.Algorithm)) {
+				versions = append(versions, version)
+			}
+		}
+	})
+	if err != nil {
+		return nil, &KeySourceError{Source: config.KeyPath, Err: err}
+	}
+
+	if len(versions) == 0 {
+		return nil, &KeyNotFoundError{Issuer: config.KeyPath}
+	}
+
+	return versions, nil
+}
+
+// isCryptoKeyPath will return true if the path names a CryptoKey rather than a CryptoKeyVersion
+func isCryptoKeyPath(path string) bool {
+	return !strings.Contains(path, "/cryptoKeyVersions/")
+}
+
+// newestKeyVersion will return the most recently created version
+func newestKeyVersion(versions []*kmspb.CryptoKeyVersion) *kmspb.CryptoKeyVersion {
+	var newest *kmspb.CryptoKeyVersion
+	for _, version := range versions {
+		if newest == nil || version.GetCreateTime().AsTime().After(newest.GetCreateTime().AsTime()) {
+			newest = version
+		}
+	}
+	return newest
+}
+
+// keyVersionForKeyID will return the version with the provided key id, or nil if not found
+func keyVersionForKeyID(versions []*kmspb.CryptoKeyVersion, kid string) *kmspb.CryptoKeyVersion {
+	for _, version := range versions {
+		if kmsKeyID(version.Name) == kid {
+			return version
+		}
+	}
+	return nil
+}
+
+// keyVersionName will return the name of the key version to sign with. If the KeyPath names a CryptoKeyVersion it is
+// returned as is, otherwise the version of the CryptoKey matching kid is returned, or the newest enabled version if
+// kid is empty. The enabled versions are cached for KeyVersionRefreshInterval, an unknown kid will refresh them at
+// most once every DefaultMinRefreshInterval.
+func (k *KMSConfig) keyVersionName(ctx context.Context, kid string) (string, error) {
+	if !isCryptoKeyPath(k.KeyPath) {
+		return k.KeyPath, nil
+	}
+
+	k.versionsMu.Lock()
+	defer k.versionsMu.Unlock()
+
+	sinceRefresh := time.Since(k.versionsRefresh)
+	if k.versions == nil || sinceRefresh >= k.keyVersionRefreshInterval() ||
+		(kid != "" && keyVersionForKeyID(k.versions, kid) == nil && sinceRefresh >= DefaultMinRefreshInterval) {
+		versions, err := listKMSKeyVersions(ctx, k)
+		if err != nil {
+			return "", err
+		}
+		k.versions = versions
+		k.versionsRefresh = time.Now()
+	}
+
+	if kid == "" {
+		return newestKeyVersion(k.versions).Name, nil
+	}
+
+	version := keyVersionForKeyID(k.versions, kid)
+	if version == nil {
+		return "", &KeyNotFoundError{KeyID: kid, Issuer: k.KeyPath}
+	}
+	return version.Name, nil
+}
+
+// keyVersionAlgorithm will return the algorithm of the named key version, as listed for the enabled versions of a
+// CryptoKey or retrieved with the GetCryptoKeyVersion API. Algorithms are cached as they never change for a version.
+func (k *KMSConfig) keyVersionAlgorithm(ctx context.Context, name string) (kmspb.CryptoKeyVersion_CryptoKeyVersionAlgorithm, error) {
+	k.versionsMu.Lock()
+	defer k.versionsMu.Unlock()
+
+	for _, version := range k.versions {
+		if version.Name == name {
+			return version.Algorithm, nil
+		}
+	}
+	if algorithm, ok := k.algorithms[name]; ok {
+		return algorithm, nil
+	}
+
+	client, err := kmsClient(ctx, k)
+	if err != nil {
+		return 0, err
+	}
+
+	request := &kmspb.GetCryptoKeyVersionRequest{Name: name}
+	var version *kmspb.CryptoKeyVersion
+	err = k.RetryPolicy.do(ctx, func() error {
+		version, err = client.GetCryptoKeyVersion(ctx, request, kmsCallOptions...)
+		return err
+	})
+	if err != nil {
+		return 0, &KeySourceError{Source: name, Err: err}
+	}
+
+	if k.algorithms == nil {
+		k.algorithms = make(map[string]kmspb.CryptoKeyVersion_CryptoKeyVersionAlgorithm)
+	}
+	k.algorithms[name] = version.Algorithm
+
+	return version.Algorithm, nil
+}
+
+// CurrentKeyID will return the key id tokens should be signed with. When KeyPath names a CryptoKey, this is the key id
+// of the newest enabled version which SigningMethodKMS will sign with if it is set as the token's kid header. When
+// KeyPath names a CryptoKeyVersion, this is the same as KeyID.
+func (k *KMSConfig) CurrentKeyID(ctx context.Context) (string, error) {
+	name, err := k.keyVersionName(ctx, "")
+	if err != nil {
+		return "", err
+	}
+	return kmsKeyID(name), nil
+}
+
+// headerKeyID will return the kid header of the JWT signing string, if any
+func headerKeyID(signingString string) (string, error) {
+	header, _, _ := strings.Cut(signingString, ".")
+	headerBytes, err := jwt.NewParser().DecodeSegment(header)
+	if err != nil {
+		return "", err
+	}
+
+	var parsed struct {
+		KeyID string `json:"kid"`
+	}
+	if err = json.Unmarshal(headerBytes, &parsed); err != nil {
+		return "", err
+	}
+	return parsed.KeyID, nil
+}
+
+// isMacSigningAlgorithm will return true for the Cloud KMS algorithms used with MacSign and MacVerify
+func isMacSigningAlgorithm(algorithm kmspb.CryptoKeyVersion_CryptoKeyVersionAlgorithm) bool {
+	switch algorithm {
+	case kmspb.CryptoKeyVersion_HMAC_SHA1,
+		kmspb.CryptoKeyVersion_HMAC_SHA224,
+		kmspb.CryptoKeyVersion_HMAC_SHA256,
+		kmspb.CryptoKeyVersion_HMAC_SHA384,
+		kmspb.CryptoKeyVersion_HMAC_SHA512:
+		return true
+	default:
+		return false
+	}
+}
+
+// isAsymmetricSigningAlgorithm will return true for the Cloud KMS algorithms used with AsymmetricSign that have a
+// matching signing method, RSA_SIGN_RAW_PKCS1 versions cannot sign tokens and are left out.
+func isAsymmetricSigningAlgorithm(algorithm kmspb.CryptoKeyVersion_CryptoKeyVersionAlgorithm) bool {
+	return kmsSigningMethodForAlgorithm(algorithm) != nil
+}
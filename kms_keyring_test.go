@@ -0,0 +1,299 @@
+package gcpjwt
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"testing"
+	"time"
+
+	kmspb "cloud.google.com/go/kms/apiv1/kmspb"
+	"github.com/golang-jwt/jwt/v5"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestKMSCryptoKeyVerfiyKeyfunc(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Errorf("could not generate key: %v", err)
+		return
+	}
+	rotatedKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Errorf("could not generate key: %v", err)
+		return
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Errorf("could not generate key: %v", err)
+		return
+	}
+
+	keyPath := "projects/p/locations/global/keyRings/r/cryptoKeys/k"
+	v1, v2, v3 := kmsKeyID(keyPath+"/cryptoKeyVersions/1"), kmsKeyID(keyPath+"/cryptoKeyVersions/2"), kmsKeyID(keyPath+"/cryptoKeyVersions/3")
+
+	fetches := 0
+	enabled := map[string]crypto.PublicKey{v1: &ecKey.PublicKey, v2: &rsaKey.PublicKey}
+	versions := &kmsKeyVersions{
+		config: &KMSConfig{KeyPath: keyPath},
+		fetch: func(ctx context.Context, config *KMSConfig, known map[string]crypto.PublicKey) (map[string]crypto.PublicKey, error) {
+			fetches++
+			keys := make(map[string]crypto.PublicKey)
+			for kid, key := range enabled {
+				keys[kid] = key
+			}
+			return keys, nil
+		},
+	}
+	keyFunc := versions.keyfunc(context.Background())
+
+	tests := []struct {
+		name    string
+		token   *jwt.Token
+		want    crypto.PublicKey
+		wantErr bool
+	}{
+		{
+			"WrongMethod",
+			&jwt.Token{Method: jwt.SigningMethodES256, Header: map[string]interface{}{"alg": "ES256", "kid": v1}},
+			nil,
+			true,
+		},
+		{
+			"ValidKID",
+			&jwt.Token{Method: SigningMethodKMSES256, Header: map[string]interface{}{"alg": SigningMethodKMSES256.Alg(), "kid": v1}},
+			&ecKey.PublicKey,
+			false,
+		},
+		{
+			"MismatchedMethod",
+			&jwt.Token{Method: SigningMethodKMSES256, Header: map[string]interface{}{"alg": SigningMethodKMSES256.Alg(), "kid": v2}},
+			nil,
+			true,
+		},
+		{
+			"UnknownKID",
+			&jwt.Token{Method: SigningMethodKMSES256, Header: map[string]interface{}{"alg": SigningMethodKMSES256.Alg(), "kid": v3}},
+			nil,
+			true,
+		},
+		{
+			"NoKID",
+			&jwt.Token{Method: SigningMethodKMSRS256, Header: map[string]interface{}{"alg": SigningMethodKMSRS256.Alg()}},
+			jwt.VerificationKeySet{Keys: []jwt.VerificationKey{&rsaKey.PublicKey}},
+			false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := keyFunc(tt.token)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("keyfunc() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if keySet, ok := got.(jwt.VerificationKeySet); ok {
+				want := tt.want.(jwt.VerificationKeySet)
+				if len(keySet.Keys) != len(want.Keys) || keySet.Keys[0] != want.Keys[0] {
+					t.Errorf("keyfunc() = %v, want %v", got, tt.want)
+				}
+			} else if got != tt.want && !(got == nil && tt.want == nil) {
+				t.Errorf("keyfunc() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if fetches != 1 {
+		t.Errorf("expected unknown kids to be rate limited to a single fetch, got %d", fetches)
+	}
+
+	// Rotate the key, the new version should be discovered once the rate limit has passed
+	enabled[v3] = &rotatedKey.PublicKey
+	versions.lastRefresh = time.Now().Add(-DefaultMinRefreshInterval)
+	got, err := keyFunc(&jwt.Token{Method: SigningMethodKMSES256, Header: map[string]interface{}{"alg": SigningMethodKMSES256.Alg(), "kid": v3}})
+	if err != nil || got != &rotatedKey.PublicKey {
+		t.Errorf("expected rotated key version to be discovered, got %v, %v", got, err)
+	}
+
+	// Disable the first version, it should be dropped after the refresh interval
+	delete(enabled, v1)
+	versions.lastRefresh = time.Now().Add(-DefaultKeyVersionRefreshInterval)
+	if _, err = keyFunc(&jwt.Token{Method: SigningMethodKMSES256, Header: map[string]interface{}{"alg": SigningMethodKMSES256.Alg(), "kid": v1}}); err == nil {
+		t.Errorf("expected disabled key version to be removed")
+	}
+}
+
+func Test_kmsKeyVersions_publicKeysFailure(t *testing.T) {
+	fail := true
+	versions := &kmsKeyVersions{
+		config: &KMSConfig{KeyPath: "invalid"},
+		fetch: func(ctx context.Context, config *KMSConfig, known map[string]crypto.PublicKey) (map[string]crypto.PublicKey, error) {
+			if fail {
+				return nil, errors.New("unavailable")
+			}
+			return map[string]crypto.PublicKey{"kid": "key"}, nil
+		},
+	}
+
+	if _, err := versions.publicKeys(context.Background(), "", false); err == nil {
+		t.Errorf("expected error without any known keys")
+	}
+
+	fail = false
+	versions.lastRefresh = time.Time{}
+	if keys, err := versions.publicKeys(context.Background(), "", false); err != nil || len(keys) != 1 {
+		t.Errorf("publicKeys() = %v, %v", keys, err)
+	}
+
+	// Known keys are served if rediscovering them fails
+	fail = true
+	versions.lastRefresh = time.Time{}
+	if keys, err := versions.publicKeys(context.Background(), "", false); err != nil || len(keys) != 1 {
+		t.Errorf("publicKeys() = %v, %v", keys, err)
+	}
+}
+
+func TestKMSConfig_keyVersionName(t *testing.T) {
+	keyPath := "projects/p/locations/global/keyRings/r/cryptoKeys/k"
+	now := time.Now()
+	versions := []*kmspb.CryptoKeyVersion{
+		{Name: keyPath + "/cryptoKeyVersions/1", CreateTime: timestamppb.New(now.Add(-2 * time.Hour))},
+		{Name: keyPath + "/cryptoKeyVersions/3", CreateTime: timestamppb.New(now)},
+		{Name: keyPath + "/cryptoKeyVersions/2", CreateTime: timestamppb.New(now.Add(-time.Hour))},
+	}
+
+	tests := []struct {
+		name    string
+		keyPath string
+		kid     string
+		want    string
+		wantErr bool
+	}{
+		{
+			"KeyVersionPath",
+			keyPath + "/cryptoKeyVersions/1",
+			"",
+			keyPath + "/cryptoKeyVersions/1",
+			false,
+		},
+		{
+			"Newest",
+			keyPath,
+			"",
+			keyPath + "/cryptoKeyVersions/3",
+			false,
+		},
+		{
+			"MatchingKID",
+			keyPath,
+			kmsKeyID(keyPath + "/cryptoKeyVersions/2"),
+			keyPath + "/cryptoKeyVersions/2",
+			false,
+		},
+		{
+			"UnknownKID",
+			keyPath,
+			"invalid",
+			"",
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Recently refreshed versions are used without calling the API
+			config := &KMSConfig{
+				KeyPath:         tt.keyPath,
+				versions:        versions,
+				versionsRefresh: time.Now(),
+			}
+			got, err := config.keyVersionName(context.Background(), tt.kid)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("KMSConfig.keyVersionName() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("KMSConfig.keyVersionName() = %v, want %v", got, tt.want)
+			}
+			if !tt.wantErr && tt.kid == "" {
+				if kid, _ := config.CurrentKeyID(context.Background()); kid != kmsKeyID(tt.want) {
+					t.Errorf("KMSConfig.CurrentKeyID() = %v, want %v", kid, kmsKeyID(tt.want))
+				}
+			}
+		})
+	}
+}
+
+func Test_headerKeyID(t *testing.T) {
+	tests := []struct {
+		name          string
+		signingString string
+		want          string
+		wantErr       bool
+	}{
+		{
+			"WithKID",
+			"eyJhbGciOiJFUzI1NiIsImtpZCI6ImFiYyJ9.eyJmb28iOiJiYXIifQ",
+			"abc",
+			false,
+		},
+		{
+			"WithoutKID",
+			"eyJ0eXAiOiJKV1QiLCJhbGciOiJSUzI1NiJ9.eyJmb28iOiJiYXIifQ",
+			"",
+			false,
+		},
+		{
+			"InvalidHeader",
+			"!!!.eyJmb28iOiJiYXIifQ",
+			"",
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := headerKeyID(tt.signingString)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("headerKeyID() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("headerKeyID() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_isSigningAlgorithm(t *testing.T) {
+	tests := []struct {
+		algorithm      kmspb.CryptoKeyVersion_CryptoKeyVersionAlgorithm
+		wantAsymmetric bool
+		wantMac        bool
+	}{
+		{kmspb.CryptoKeyVersion_RSA_SIGN_PKCS1_2048_SHA256, true, false},
+		{kmspb.CryptoKeyVersion_RSA_SIGN_PKCS1_4096_SHA512, true, false},
+		{kmspb.CryptoKeyVersion_RSA_SIGN_PSS_3072_SHA256, true, false},
+		{kmspb.CryptoKeyVersion_RSA_SIGN_PSS_4096_SHA512, true, false},
+		{kmspb.CryptoKeyVersion_EC_SIGN_P256_SHA256, true, false},
+		{kmspb.CryptoKeyVersion_EC_SIGN_P384_SHA384, true, false},
+		{kmspb.CryptoKeyVersion_EC_SIGN_SECP256K1_SHA256, true, false},
+		{kmspb.CryptoKeyVersion_EC_SIGN_ED25519, true, false},
+		{kmspb.CryptoKeyVersion_RSA_SIGN_RAW_PKCS1_2048, false, false},
+		{kmspb.CryptoKeyVersion_RSA_DECRYPT_OAEP_2048_SHA256, false, false},
+		{kmspb.CryptoKeyVersion_GOOGLE_SYMMETRIC_ENCRYPTION, false, false},
+		{kmspb.CryptoKeyVersion_HMAC_SHA256, false, true},
+		{kmspb.CryptoKeyVersion_HMAC_SHA1, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.algorithm.String(), func(t *testing.T) {
+			if got := isAsymmetricSigningAlgorithm(tt.algorithm); got != tt.wantAsymmetric {
+				t.Errorf("isAsymmetricSigningAlgorithm() = %v, want %v", got, tt.wantAsymmetric)
+			}
+			if got := isMacSigningAlgorithm(tt.algorithm); got != tt.wantMac {
+				t.Errorf("isMacSigningAlgorithm() = %v, want %v", got, tt.wantMac)
+			}
+		})
+	}
+}
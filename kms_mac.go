@@ -0,0 +1,260 @@
+package gcpjwt
+
+import (
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	kmspb "cloud.google.com/go/kms/apiv1/kmspb"
+	"github.com/golang-jwt/jwt/v5"
+	cache "github.com/patrickmn/go-cache"
+)
+
+// SigningMethodKMSHMAC implements the jwt.SiginingMethod interface for Google's Cloud KMS service using HMAC keys with
+// the MacSign and MacVerify APIs, the key material never leaves Cloud KMS.
+type SigningMethodKMSHMAC struct {
+	alg       string
+	override  jwt.SigningMethod
+	hasher    crypto.Hash
+	algorithm kmspb.CryptoKeyVersion_CryptoKeyVersionAlgorithm
+}
+
+// Support for the Google Cloud KMS MAC Signing Algorithms: https://cloud.google.com/kms/docs/algorithms#hmac_signing_algorithms
+var (
+	// SigningMethodKMSHS256 leverages Cloud KMS for the HS256 algorithm, use with:
+	// HMAC_SHA256
+	SigningMethodKMSHS256 *SigningMethodKMSHMAC
+	// SigningMethodKMSHS384 leverages Cloud KMS for the HS384 algorithm, use with:
+	// HMAC_SHA384
+	SigningMethodKMSHS384 *SigningMethodKMSHMAC
+	// SigningMethodKMSHS512 leverages Cloud KMS for the HS512 algorithm, use with:
+	// HMAC_SHA512
+	SigningMethodKMSHS512 *SigningMethodKMSHMAC
+)
+
+func init() {
+	// HS256
+	SigningMethodKMSHS256 = &SigningMethodKMSHMAC{
+		"KMSHS256",
+		jwt.SigningMethodHS256,
+		crypto.SHA256,
+		kmspb.CryptoKeyVersion_HMAC_SHA256,
+	}
+	jwt.RegisterSigningMethod(SigningMethodKMSHS256.Alg(), func() jwt.SigningMethod {
+		return SigningMethodKMSHS256
+	})
+
+	// HS384
+	SigningMethodKMSHS384 = &SigningMethodKMSHMAC{
+		"KMSHS384",
+		jwt.SigningMethodHS384,
+		crypto.SHA384,
+		kmspb.CryptoKeyVersion_HMAC_SHA384,
+	}
+	jwt.RegisterSigningMethod(SigningMethodKMSHS384.Alg(), func() jwt.SigningMethod {
+		return SigningMethodKMSHS384
+	})
+
+	// HS512
+	SigningMethodKMSHS512 = &SigningMethodKMSHMAC{
+		"KMSHS512",
+		jwt.SigningMethodHS512,
+		crypto.SHA512,
+		kmspb.CryptoKeyVersion_HMAC_SHA512,
+	}
+	jwt.RegisterSigningMethod(SigningMethodKMSHS512.Alg(), func() jwt.SigningMethod {
+		return SigningMethodKMSHS512
+	})
+}
+
+// Alg will return the JWT header algorithm identifier this method is configured for.
+func (s *SigningMethodKMSHMAC) Alg() string {
+	return s.alg
+}
+
+// Override will override the default JWT implementation of the signing function this Cloud KMS type implements.
+func (s *SigningMethodKMSHMAC) Override() {
+	s.alg = s.override.Alg()
+	jwt.RegisterSigningMethod(s.alg, func() jwt.SigningMethod {
+		return s
+	})
+}
+
+// Hash will return the crypto.Hash used for this signing method
+func (s *SigningMethodKMSHMAC) Hash() crypto.Hash {
+	return s.hasher
+}
+
+// Sign implements the Sign method from jwt.SigningMethod. For this signing method, a valid context.Context must be
+// passed as the key containing a KMSConfig value. The key version's algorithm must match the signing method.
+// https://cloud.google.com/kms/docs/create-validate-signatures#mac
+func (s *SigningMethodKMSHMAC) Sign(signingString string, key interface{}) ([]byte, error) {
+	ctx, config, err := kmsContextKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	name, err := s.keyVersion(ctx, config, signingString)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := kmsClient(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+
+	// Do the call
+	request := &kmspb.MacSignRequest{
+		Name:       name,
+		Data:       []byte(signingString),
+		DataCrc32C: crc32c([]byte(signingString)),
+	}
+	var signResp *kmspb.MacSignResponse
+	err = config.RetryPolicy.do(ctx, func() error {
+		signResp, err = client.MacSign(ctx, request, kmsCallOptions...)
+		if err != nil {
+			return err
+		}
+		return checkMacSignResponse(request, signResp)
+	})
+	if err != nil {
+		return nil, &SigningError{Name: name, Err: err}
+	}
+
+	return signResp.Mac, nil
+}
+
+// Verify implements the Verify method from jwt.SigningMethod. For this signing method, a valid context.Context must be
+// passed as the key containing a KMSConfig value, see KMSHMACVerfiyKeyfunc. The signature is verified with the
+// MacVerify API unless it was already successfully verified and KMSConfig.EnableVerifyCache is true. Tokens are
+// rejected with an error wrapping ErrUnexpectedSigningMethod if the key version's algorithm does not match the signing
+// method.
+// https://cloud.google.com/kms/docs/create-validate-signatures#validate_mac
+func (s *SigningMethodKMSHMAC) Verify(signingString string, signature []byte, key interface{}) error {
+	ctx, config, err := kmsContextKey(key)
+	if err != nil {
+		return err
+	}
+
+	var tokenHash string
+	if config.EnableVerifyCache {
+		hash := sha256.New()
+		_, _ = hash.Write([]byte(signingString))
+		_, _ = hash.Write([]byte{'.'})
+		_, _ = hash.Write(signature)
+		tokenHash = hex.EncodeToString(hash.Sum(nil))
+
+		if _, found := config.verifiedTokens().Get(tokenHash); found {
+			return nil
+		}
+	}
+
+	name, err := s.keyVersion(ctx, config, signingString)
+	if err != nil {
+		return err
+	}
+
+	client, err := kmsClient(ctx, config)
+	if err != nil {
+		return err
+	}
+
+	// Do the call
+	request := &kmspb.MacVerifyRequest{
+		Name:       name,
+		Data:       []byte(signingString),
+		DataCrc32C: crc32c([]byte(signingString)),
+		Mac:        signature,
+		MacCrc32C:  crc32c(signature),
+	}
+	var verifyResp *kmspb.MacVerifyResponse
+	err = config.RetryPolicy.do(ctx, func() error {
+		verifyResp, err = client.MacVerify(ctx, request, kmsCallOptions...)
+		if err != nil {
+			return err
+		}
+		return checkMacVerifyResponse(request, verifyResp)
+	})
+	if err != nil {
+		return &SigningError{Name: name, Err: err}
+	}
+	if !verifyResp.Success {
+		return jwt.ErrSignatureInvalid
+	}
+
+	if config.EnableVerifyCache {
+		config.verifiedTokens().Set(tokenHash, struct{}{}, cache.DefaultExpiration)
+	}
+
+	return nil
+}
+
+// KMSHMACVerfiyKeyfunc is a helper meant that returns a jwt.Keyfunc for the Cloud KMS HMAC signing methods. The
+// returned key is a context.Context carrying the provided KMSConfig which is used to call the MacVerify API. If the
+// KeyPath names a CryptoKey, tokens are verified with the enabled version matching their kid header, or the newest
+// enabled version if they have none.
+func KMSHMACVerfiyKeyfunc(ctx context.Context, config *KMSConfig) jwt.Keyfunc {
+	keyVersion := config.KeyID()
+	verifyCtx := NewKMSContext(ctx, config)
+
+	return func(token *jwt.Token) (interface{}, error) {
+		// Make sure we have the proper header alg
+		if _, ok := token.Method.(*SigningMethodKMSHMAC); !ok {
+			return nil, fmt.Errorf("%w: %v", ErrUnexpectedSigningMethod, token.Header["alg"])
+		}
+
+		// The key version matching the kid of a CryptoKey is picked when verifying
+		if kid, ok := token.Header["kid"].(string); ok && !isCryptoKeyPath(config.KeyPath) {
+			if kid != keyVersion {
+				return nil, &KeyNotFoundError{KeyID: kid, Issuer: config.KeyPath}
+			}
+		}
+
+		return verifyCtx, nil
+	}
+}
+
+// keyVersion will return the name of the key version to sign or verify the signing string with, picking the version
+// matching the token's kid when the KeyPath names a CryptoKey. An error wrapping ErrUnexpectedSigningMethod is
+// returned if the key version's algorithm does not match this signing method.
+func (s *SigningMethodKMSHMAC) keyVersion(ctx context.Context, config *KMSConfig, signingString string) (string, error) {
+	var kid string
+	if isCryptoKeyPath(config.KeyPath) {
+		var err error
+		if kid, err = headerKeyID(signingString); err != nil {
+			return "", fmt.Errorf("gcpjwt: could not decode token header: %v", err)
+		}
+	}
+	name, err := config.keyVersionName(ctx, kid)
+	if err != nil {
+		return "", err
+	}
+
+	algorithm, err := config.keyVersionAlgorithm(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	if algorithm != s.algorithm {
+		return "", fmt.Errorf("%w: %v cannot be used with key version `%s` of algorithm %v", ErrUnexpectedSigningMethod, s.Alg(), name, algorithm)
+	}
+
+	return name, nil
+}
+
+// kmsContextKey will extract the KMSConfig from a key that must be a context.Context
+func kmsContextKey(key interface{}) (context.Context, *KMSConfig, error) {
+	ctx, ok := key.(context.Context)
+	if !ok {
+		return nil, nil, jwt.ErrInvalidKey
+	}
+
+	config, ok := KMSFromContext(ctx)
+	if !ok {
+		return nil, nil, ErrMissingConfig
+	}
+
+	return ctx, config, nil
+}
@@ -0,0 +1,422 @@
+package gcpjwt
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	kms "cloud.google.com/go/kms/apiv1"
+	kmspb "cloud.google.com/go/kms/apiv1/kmspb"
+	"github.com/golang-jwt/jwt/v5"
+	cache "github.com/patrickmn/go-cache"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestKMSHMACSignAndVerify(t *testing.T) {
+	if os.Getenv("KMS_TEST_MAC_KEYS") == "" {
+		t.Skip("environmental variable KMS_TEST_MAC_KEYS missing")
+	}
+	testKeys, err := readKeysFrom("KMS_TEST_MAC_KEYS")
+	if err != nil {
+		t.Errorf("could not read keys: %v", err)
+		return
+	}
+
+	ctx, err := newContextFunc()
+	if err != nil {
+		t.Errorf("could not get new context: %v", err)
+		return
+	}
+
+	for _, tt := range testKeys {
+		t.Run(tt.Name, func(t *testing.T) {
+			config := &KMSConfig{
+				KeyPath:           tt.KeyPath,
+				EnableVerifyCache: true,
+			}
+			method := jwt.GetSigningMethod("KMS" + tt.Alg)
+			if method == nil {
+				t.Errorf("Uknown alg = %s", tt.Alg)
+				return
+			}
+
+			token := jwt.NewWithClaims(method, jwt.MapClaims{"foo": "bar"})
+			token.Header["kid"] = config.KeyID()
+			tokenStr, err := token.SignedString(NewKMSContext(ctx, config))
+			if err != nil {
+				t.Errorf("could not sign token: %v", err)
+				return
+			}
+
+			// Verify twice to exercise the verify cache
+			for i := 0; i < 2; i++ {
+				if _, err = jwt.Parse(tokenStr, KMSHMACVerfiyKeyfunc(ctx, config)); err != nil {
+					t.Errorf("could not verify token: %v", err)
+					return
+				}
+			}
+
+			if _, err = jwt.Parse(tokenStr+"a", KMSHMACVerfiyKeyfunc(ctx, config)); err == nil {
+				t.Errorf("expected error verifying modified token")
+			}
+		})
+	}
+}
+
+func TestSigningMethodKMSHMAC_Override(t *testing.T) {
+	tests := []struct {
+		name string
+		s    *SigningMethodKMSHMAC
+	}{
+		{
+			"HS256",
+			SigningMethodKMSHS256,
+		},
+		{
+			"HS384",
+			SigningMethodKMSHS384,
+		},
+		{
+			"HS512",
+			SigningMethodKMSHS512,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := jwt.GetSigningMethod(tt.s.Alg())
+			if method != tt.s {
+				t.Errorf("method = `%v`, expected `%v'", method, tt.s)
+			}
+			tt.s.Override()
+			method = jwt.GetSigningMethod(tt.s.override.Alg())
+			if method != tt.s {
+				t.Errorf("method = `%v`, expected `%v'", method, tt.s)
+			}
+		})
+	}
+}
+
+func TestSigningMethodKMSHMAC_SignAndVerifyErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     interface{}
+		wantErr error
+	}{
+		{
+			"InvalidKey",
+			"",
+			jwt.ErrInvalidKey,
+		},
+		{
+			"MissingConfig",
+			context.Background(),
+			ErrMissingConfig,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := SigningMethodKMSHS256.Sign("", tt.key); err != tt.wantErr {
+				t.Errorf("SigningMethodKMSHMAC.Sign() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err := SigningMethodKMSHS256.Verify("", nil, tt.key); err != tt.wantErr {
+				t.Errorf("SigningMethodKMSHMAC.Verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSigningMethodKMSHMAC_VerifyCached(t *testing.T) {
+	config := &KMSConfig{
+		KeyPath:           "invalid",
+		EnableVerifyCache: true,
+	}
+	signingString, signature := "eyJhbGciOiJIUzI1NiJ9.eyJmb28iOiJiYXIifQ", []byte("signature")
+
+	hash := sha256.Sum256([]byte(signingString + "." + string(signature)))
+	config.verifiedTokens().Set(hex.EncodeToString(hash[:]), struct{}{}, cache.DefaultExpiration)
+
+	// A cached token must not call the API, which would fail for the invalid key path
+	if err := SigningMethodKMSHS256.Verify(signingString, signature, NewKMSContext(context.Background(), config)); err != nil {
+		t.Errorf("SigningMethodKMSHMAC.Verify() error = %v", err)
+	}
+}
+
+func TestKMSHMACVerfiyKeyfunc(t *testing.T) {
+	config := &KMSConfig{KeyPath: "projects/p/locations/global/keyRings/r/cryptoKeys/k/cryptoKeyVersions/1"}
+	tests := []struct {
+		name    string
+		token   *jwt.Token
+		wantErr bool
+	}{
+		{
+			"WrongMethod",
+			&jwt.Token{
+				Method: jwt.SigningMethodHS256,
+				Header: map[string]interface{}{"alg": "HS256"},
+			},
+			true,
+		},
+		{
+			"WrongKID",
+			&jwt.Token{
+				Method: SigningMethodKMSHS256,
+				Header: map[string]interface{}{"alg": SigningMethodKMSHS256.Alg(), "kid": "invalid"},
+			},
+			true,
+		},
+		{
+			"ValidKID",
+			&jwt.Token{
+				Method: SigningMethodKMSHS256,
+				Header: map[string]interface{}{"alg": SigningMethodKMSHS256.Alg(), "kid": config.KeyID()},
+			},
+			false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := KMSHMACVerfiyKeyfunc(context.Background(), config)(tt.token)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("KMSHMACVerfiyKeyfunc() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err == nil {
+				if got, ok := KMSFromContext(key.(context.Context)); !ok || got != config {
+					t.Errorf("expected key to carry the KMSConfig")
+				}
+			}
+		})
+	}
+}
+
+// fakeMacKMS implements the Cloud KMS APIs used by the HMAC signing methods for HMAC_SHA256 key versions of a single
+// CryptoKey
+type fakeMacKMS struct {
+	kmspb.UnimplementedKeyManagementServiceServer
+	key []byte
+
+	mu          sync.Mutex
+	versions    []*kmspb.CryptoKeyVersion
+	gets        int
+	unavailable bool
+	macSigns    int
+}
+
+func (f *fakeMacKMS) version(name string) *kmspb.CryptoKeyVersion {
+	for _, version := range f.versions {
+		if version.Name == name {
+			return version
+		}
+	}
+	return nil
+}
+
+func (f *fakeMacKMS) mac(name string, data []byte) []byte {
+	h := hmac.New(sha256.New, append([]byte(name), f.key...))
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+func (f *fakeMacKMS) GetCryptoKeyVersion(_ context.Context, req *kmspb.GetCryptoKeyVersionRequest) (*kmspb.CryptoKeyVersion, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.gets++
+	if version := f.version(req.Name); version != nil {
+		return version, nil
+	}
+	return nil, errors.New("not found")
+}
+
+func (f *fakeMacKMS) ListCryptoKeyVersions(_ context.Context, req *kmspb.ListCryptoKeyVersionsRequest) (*kmspb.ListCryptoKeyVersionsResponse, error) {
+	return &kmspb.ListCryptoKeyVersionsResponse{CryptoKeyVersions: f.versions, TotalSize: int32(len(f.versions))}, nil
+}
+
+func (f *fakeMacKMS) MacSign(_ context.Context, req *kmspb.MacSignRequest) (*kmspb.MacSignResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.macSigns++
+	if f.unavailable {
+		return nil, status.Error(codes.Unavailable, "unavailable")
+	}
+
+	mac := f.mac(req.Name, req.Data)
+	return &kmspb.MacSignResponse{
+		Name:               req.Name,
+		Mac:                mac,
+		MacCrc32C:          crc32c(mac),
+		VerifiedDataCrc32C: true,
+	}, nil
+}
+
+func (f *fakeMacKMS) MacVerify(_ context.Context, req *kmspb.MacVerifyRequest) (*kmspb.MacVerifyResponse, error) {
+	success := hmac.Equal(f.mac(req.Name, req.Data), req.Mac)
+	return &kmspb.MacVerifyResponse{
+		Name:                     req.Name,
+		Success:                  success,
+		VerifiedDataCrc32C:       true,
+		VerifiedMacCrc32C:        true,
+		VerifiedSuccessIntegrity: success,
+	}, nil
+}
+
+func newFakeMacKMSClient(t *testing.T, fake *fakeMacKMS) *kms.KeyManagementClient {
+	t.Helper()
+	listener := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer()
+	kmspb.RegisterKeyManagementServiceServer(server, fake)
+	go func() { _ = server.Serve(listener) }()
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	client, err := kms.NewKeyManagementClient(context.Background(), option.WithGRPCConn(conn))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestSigningMethodKMSHMAC_KeyVersionAlgorithm(t *testing.T) {
+	const cryptoKey = "projects/p/locations/global/keyRings/r/cryptoKeys/k"
+	fake := &fakeMacKMS{
+		key: []byte("secret"),
+		versions: []*kmspb.CryptoKeyVersion{
+			{Name: cryptoKey + "/cryptoKeyVersions/1", State: kmspb.CryptoKeyVersion_ENABLED, Algorithm: kmspb.CryptoKeyVersion_HMAC_SHA256},
+			{Name: cryptoKey + "/cryptoKeyVersions/2", State: kmspb.CryptoKeyVersion_ENABLED, Algorithm: kmspb.CryptoKeyVersion_HMAC_SHA256},
+		},
+	}
+	client := newFakeMacKMSClient(t, fake)
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		keyPath string
+		kid     string
+		method  *SigningMethodKMSHMAC
+		wantErr error
+	}{
+		{"KeyVersion", cryptoKey + "/cryptoKeyVersions/1", "", SigningMethodKMSHS256, nil},
+		{"CryptoKey", cryptoKey, "", SigningMethodKMSHS256, nil},
+		{"CryptoKeyKID", cryptoKey, kmsKeyID(cryptoKey + "/cryptoKeyVersions/1"), SigningMethodKMSHS256, nil},
+		{"UnknownKID", cryptoKey, kmsKeyID(cryptoKey + "/cryptoKeyVersions/3"), SigningMethodKMSHS256, ErrKeyNotFound},
+		{"AlgorithmMismatch", cryptoKey + "/cryptoKeyVersions/1", "", SigningMethodKMSHS512, ErrUnexpectedSigningMethod},
+		{"CryptoKeyAlgorithmMismatch", cryptoKey, "", SigningMethodKMSHS384, ErrUnexpectedSigningMethod},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &KMSConfig{KeyPath: tt.keyPath, KMSClient: client}
+			token := jwt.NewWithClaims(tt.method, jwt.MapClaims{"foo": "bar"})
+			if tt.kid != "" {
+				token.Header["kid"] = tt.kid
+			}
+			signingString, err := token.SigningString()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			signature, err := tt.method.Sign(signingString, NewKMSContext(ctx, config))
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("SigningMethodKMSHMAC.Sign() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr != nil {
+				// A token signed by the HS256 key but labelled otherwise must not verify either
+				signature, err = SigningMethodKMSHS256.Sign(signingString, NewKMSContext(ctx, &KMSConfig{KeyPath: cryptoKey + "/cryptoKeyVersions/1", KMSClient: client}))
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err = tt.method.Verify(signingString, signature, NewKMSContext(ctx, config))
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("SigningMethodKMSHMAC.Verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	// Algorithms of key versions named in the KeyPath are only fetched once per config
+	fake.gets = 0
+	config := &KMSConfig{KeyPath: cryptoKey + "/cryptoKeyVersions/2", KMSClient: client}
+	for i := 0; i < 2; i++ {
+		tokenString, err := jwt.NewWithClaims(SigningMethodKMSHS256, jwt.MapClaims{"foo": "bar"}).SignedString(NewKMSContext(ctx, config))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = jwt.Parse(tokenString, KMSHMACVerfiyKeyfunc(ctx, config)); err != nil {
+			t.Errorf("could not verify token: %v", err)
+		}
+	}
+	if fake.gets != 1 {
+		t.Errorf("GetCryptoKeyVersion calls = %v, want 1", fake.gets)
+	}
+}
+
+func TestSigningMethodKMSHMAC_RetryPolicy(t *testing.T) {
+	const keyPath = "projects/p/locations/global/keyRings/r/cryptoKeys/k/cryptoKeyVersions/1"
+	fake := &fakeMacKMS{
+		key:         []byte("secret"),
+		versions:    []*kmspb.CryptoKeyVersion{{Name: keyPath, Algorithm: kmspb.CryptoKeyVersion_HMAC_SHA256}},
+		unavailable: true,
+	}
+	config := &KMSConfig{
+		KeyPath:     keyPath,
+		KMSClient:   newFakeMacKMSClient(t, fake),
+		RetryPolicy: &RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond},
+	}
+
+	// Only the RetryPolicy retries calls, the client's own retries would multiply the attempts
+	_, err := SigningMethodKMSHS256.Sign("eyJhbGciOiJIUzI1NiJ9.eyJmb28iOiJiYXIifQ", NewKMSContext(context.Background(), config))
+	var retryErr *RetryError
+	if !errors.As(err, &retryErr) || len(retryErr.Attempts) != 2 {
+		t.Errorf("SigningMethodKMSHMAC.Sign() error = %v, want *RetryError with 2 attempts", err)
+	}
+	if fake.macSigns != 2 {
+		t.Errorf("MacSign calls = %v, want 2", fake.macSigns)
+	}
+}
+
+func TestSignToken_KMSHMACCryptoKey(t *testing.T) {
+	const cryptoKey = "projects/p/locations/global/keyRings/r/cryptoKeys/k"
+	fake := &fakeMacKMS{
+		key: []byte("secret"),
+		versions: []*kmspb.CryptoKeyVersion{
+			{Name: cryptoKey + "/cryptoKeyVersions/1", State: kmspb.CryptoKeyVersion_ENABLED, Algorithm: kmspb.CryptoKeyVersion_HMAC_SHA256},
+			{Name: cryptoKey + "/cryptoKeyVersions/2", State: kmspb.CryptoKeyVersion_ENABLED, Algorithm: kmspb.CryptoKeyVersion_HMAC_SHA256},
+		},
+	}
+	ctx := context.Background()
+	config := &KMSConfig{KeyPath: cryptoKey, KMSClient: newFakeMacKMSClient(t, fake)}
+
+	tokenString, err := SignToken(NewKMSContext(ctx, config), SigningMethodKMSHS256, jwt.MapClaims{"foo": "bar"})
+	if err != nil {
+		t.Errorf("SignToken() error = %v", err)
+		return
+	}
+
+	token, err := jwt.Parse(tokenString, KMSHMACVerfiyKeyfunc(ctx, config))
+	if err != nil {
+		t.Errorf("could not verify token: %v", err)
+		return
+	}
+	kid, err := config.CurrentKeyID(ctx)
+	if err != nil || token.Header["kid"] != kid {
+		t.Errorf("kid = %v, want %v (%v)", token.Header["kid"], kid, err)
+	}
+}
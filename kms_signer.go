@@ -0,0 +1,99 @@
+package gcpjwt
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"fmt"
+	"io"
+
+	kmspb "cloud.google.com/go/kms/apiv1/kmspb"
+)
+
+// KMSSigner implements crypto.Signer using a Cloud KMS asymmetric signing key version, allowing the key to be used
+// with crypto/tls, x509.CreateCertificate, SSH, or any other library that accepts a crypto.Signer.
+type KMSSigner struct {
+	ctx       context.Context
+	config    *KMSConfig
+	name      string
+	publicKey crypto.PublicKey
+	pss       bool
+}
+
+// NewKMSSigner returns a KMSSigner for the key version configured in the provided KMSConfig. If the KeyPath names a
+// CryptoKey, the newest enabled version is used for the lifetime of the signer. The public key is retrieved when
+// creating the signer and the provided context.Context is used for all subsequent calls to the API.
+func NewKMSSigner(ctx context.Context, config *KMSConfig) (*KMSSigner, error) {
+	name, err := config.keyVersionName(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+
+	publicKey, algorithm, err := fetchKMSPublicKey(ctx, config, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &KMSSigner{
+		ctx:       ctx,
+		config:    config,
+		name:      name,
+		publicKey: publicKey,
+		pss:       isPSSAlgorithm(algorithm),
+	}, nil
+}
+
+// Public returns the public key of the configured key version.
+func (k *KMSSigner) Public() crypto.PublicKey {
+	return k.publicKey
+}
+
+// Sign signs the digest with the configured key version. The digest must be the result of hashing the message with
+// the SHA-256, SHA-384, or SHA-512 hash function provided by opts, matching the key's algorithm. RSA-PSS keys must be
+// used with *rsa.PSSOptions where the salt length equals the hash length, as that is what Cloud KMS uses. ECDSA
+// signatures are returned ASN1 encoded. Ed25519 keys sign the message itself, as ed25519.PrivateKey does, and do not
+// support Ed25519ph or Ed25519ctx. The rand argument is ignored.
+func (k *KMSSigner) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	hash := opts.HashFunc()
+	if _, isEd25519 := k.publicKey.(ed25519.PublicKey); isEd25519 {
+		if edOpts, ok := opts.(*ed25519.Options); hash != 0 || (ok && edOpts.Context != "") {
+			return nil, fmt.Errorf("gcpjwt: Cloud KMS only supports pure Ed25519 signatures")
+		}
+		return signKMS(k.ctx, k.config, k.name, 0, digest)
+	}
+
+	switch hash {
+	case crypto.SHA256, crypto.SHA384, crypto.SHA512:
+	default:
+		return nil, fmt.Errorf("gcpjwt: unsupported hash function for Cloud KMS: %v", hash)
+	}
+	if len(digest) != hash.Size() {
+		return nil, fmt.Errorf("gcpjwt: digest length of %d does not match hash function %v", len(digest), hash)
+	}
+
+	pssOpts, isPSS := opts.(*rsa.PSSOptions)
+	if isPSS != k.pss {
+		return nil, fmt.Errorf("gcpjwt: signer options do not match the key's padding scheme")
+	}
+	if isPSS && pssOpts.SaltLength != rsa.PSSSaltLengthEqualsHash && pssOpts.SaltLength != hash.Size() {
+		return nil, fmt.Errorf("gcpjwt: Cloud KMS only supports PSS salt lengths equal to the hash length")
+	}
+
+	return signKMS(k.ctx, k.config, k.name, hash, digest)
+}
+
+// isPSSAlgorithm will return true for the Cloud KMS RSA-PSS signing algorithms
+func isPSSAlgorithm(algorithm kmspb.CryptoKeyVersion_CryptoKeyVersionAlgorithm) bool {
+	switch algorithm {
+	case kmspb.CryptoKeyVersion_RSA_SIGN_PSS_2048_SHA256,
+		kmspb.CryptoKeyVersion_RSA_SIGN_PSS_3072_SHA256,
+		kmspb.CryptoKeyVersion_RSA_SIGN_PSS_4096_SHA256,
+		kmspb.CryptoKeyVersion_RSA_SIGN_PSS_4096_SHA512:
+		return true
+	default:
+		return false
+	}
+}
+
+var _ crypto.Signer = (*KMSSigner)(nil)
@@ -0,0 +1,183 @@
+package gcpjwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"testing"
+
+	kmspb "cloud.google.com/go/kms/apiv1/kmspb"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	secp256k1ecdsa "github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+)
+
+func TestKMSSignerSignAndVerify(t *testing.T) {
+	testKeys, err := readKeys()
+	if err != nil {
+		t.Errorf("could not read keys: %v", err)
+		return
+	}
+
+	ctx, err := newContextFunc()
+	if err != nil {
+		t.Errorf("could not get new context: %v", err)
+		return
+	}
+
+	for _, tt := range testKeys {
+		t.Run(tt.Name, func(t *testing.T) {
+			signer, err := NewKMSSigner(ctx, &KMSConfig{KeyPath: tt.KeyPath})
+			if err != nil {
+				t.Errorf("could not create signer: %v", err)
+				return
+			}
+
+			method := algToMethod(tt.Alg).(*SigningMethodKMS)
+			digest := []byte("test message")
+			if method.Hash() != 0 {
+				hasher := method.Hash().New()
+				_, _ = hasher.Write(digest)
+				digest = hasher.Sum(nil)
+			}
+
+			var opts crypto.SignerOpts = method.Hash()
+			if signer.pss {
+				opts = &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: method.Hash()}
+			}
+
+			signature, err := signer.Sign(rand.Reader, digest, opts)
+			if err != nil {
+				t.Errorf("could not sign digest: %v", err)
+				return
+			}
+
+			switch publicKey := signer.Public().(type) {
+			case *rsa.PublicKey:
+				if signer.pss {
+					err = rsa.VerifyPSS(publicKey, method.Hash(), digest, signature, opts.(*rsa.PSSOptions))
+				} else {
+					err = rsa.VerifyPKCS1v15(publicKey, method.Hash(), digest, signature)
+				}
+			case *ecdsa.PublicKey:
+				if !ecdsa.VerifyASN1(publicKey, digest, signature) {
+					err = rsa.ErrVerification
+				}
+			case *secp256k1.PublicKey:
+				var sig *secp256k1ecdsa.Signature
+				if sig, err = secp256k1ecdsa.ParseDERSignature(signature); err == nil && !sig.Verify(digest, publicKey) {
+					err = rsa.ErrVerification
+				}
+			case ed25519.PublicKey:
+				if !ed25519.Verify(publicKey, digest, signature) {
+					err = rsa.ErrVerification
+				}
+			default:
+				t.Errorf("unexpected public key type %T", publicKey)
+				return
+			}
+			if err != nil {
+				t.Errorf("could not verify signature: %v", err)
+			}
+		})
+	}
+}
+
+func TestKMSSigner_Sign(t *testing.T) {
+	sha256Digest := sha256.Sum256([]byte("test"))
+	sha512Digest := sha512.Sum512([]byte("test"))
+	_, ed25519Key, _ := ed25519.GenerateKey(rand.Reader)
+	tests := []struct {
+		name      string
+		pss       bool
+		publicKey crypto.PublicKey
+		digest    []byte
+		opts      crypto.SignerOpts
+	}{
+		{
+			"UnsupportedHash",
+			false,
+			nil,
+			sha256Digest[:],
+			crypto.SHA1,
+		},
+		{
+			"DigestLengthMismatch",
+			false,
+			nil,
+			sha256Digest[:],
+			crypto.SHA512,
+		},
+		{
+			"PSSOptionsForPKCS1Key",
+			false,
+			nil,
+			sha512Digest[:],
+			&rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: crypto.SHA512},
+		},
+		{
+			"PKCS1OptionsForPSSKey",
+			true,
+			nil,
+			sha256Digest[:],
+			crypto.SHA256,
+		},
+		{
+			"UnsupportedSaltLength",
+			true,
+			nil,
+			sha256Digest[:],
+			&rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthAuto, Hash: crypto.SHA256},
+		},
+		{
+			"Ed25519ph",
+			false,
+			ed25519Key.Public(),
+			sha512Digest[:],
+			&ed25519.Options{Hash: crypto.SHA512},
+		},
+		{
+			"Ed25519ctx",
+			false,
+			ed25519Key.Public(),
+			[]byte("test"),
+			&ed25519.Options{Context: "context"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k := &KMSSigner{
+				config:    &KMSConfig{KeyPath: "invalid"},
+				publicKey: tt.publicKey,
+				pss:       tt.pss,
+			}
+			if _, err := k.Sign(rand.Reader, tt.digest, tt.opts); err == nil {
+				t.Errorf("KMSSigner.Sign() expected error")
+			}
+		})
+	}
+}
+
+func Test_isPSSAlgorithm(t *testing.T) {
+	tests := []struct {
+		algorithm kmspb.CryptoKeyVersion_CryptoKeyVersionAlgorithm
+		want      bool
+	}{
+		{kmspb.CryptoKeyVersion_RSA_SIGN_PSS_2048_SHA256, true},
+		{kmspb.CryptoKeyVersion_RSA_SIGN_PSS_4096_SHA512, true},
+		{kmspb.CryptoKeyVersion_RSA_SIGN_PKCS1_2048_SHA256, false},
+		{kmspb.CryptoKeyVersion_RSA_SIGN_RAW_PKCS1_2048, false},
+		{kmspb.CryptoKeyVersion_RSA_DECRYPT_OAEP_2048_SHA256, false},
+		{kmspb.CryptoKeyVersion_EC_SIGN_P256_SHA256, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.algorithm.String(), func(t *testing.T) {
+			if got := isPSSAlgorithm(tt.algorithm); got != tt.want {
+				t.Errorf("isPSSAlgorithm() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
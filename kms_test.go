@@ -10,7 +10,8 @@ import (
 	"strings"
 	"testing"
 
-	"github.com/dgrijalva/jwt-go"
+	kmspb "cloud.google.com/go/kms/apiv1/kmspb"
+	"github.com/golang-jwt/jwt/v5"
 )
 
 type testKey struct {
@@ -21,9 +22,13 @@ type testKey struct {
 }
 
 func readKeys() ([]testKey, error) {
-	path := os.Getenv("KMS_TEST_KEYS")
+	return readKeysFrom("KMS_TEST_KEYS")
+}
+
+func readKeysFrom(env string) ([]testKey, error) {
+	path := os.Getenv(env)
 	if path == "" {
-		return nil, fmt.Errorf("environmental variable KMS_TEST_KEYS missing")
+		return nil, fmt.Errorf("environmental variable %s missing", env)
 	}
 
 	b, err := ioutil.ReadFile(path)
@@ -50,6 +55,14 @@ func algToMethod(alg string) jwt.SigningMethod {
 		return SigningMethodKMSES256
 	case "ES384":
 		return SigningMethodKMSES384
+	case "RS512":
+		return SigningMethodKMSRS512
+	case "PS512":
+		return SigningMethodKMSPS512
+	case "ES256K":
+		return SigningMethodKMSES256K
+	case "EdDSA":
+		return SigningMethodKMSEdDSA
 	}
 	return nil
 }
@@ -141,7 +154,7 @@ func TestKMSSignAndVerify(t *testing.T) {
 					}
 
 					// Parse token
-					token, parts, err := new(jwt.Parser).ParseUnverified(tokenStr, jwt.MapClaims{})
+					token, parts, err := jwt.NewParser().ParseUnverified(tokenStr, jwt.MapClaims{})
 					if err != nil {
 						t.Errorf("could not parse token: %v", err)
 						return
@@ -159,7 +172,7 @@ func TestKMSSignAndVerify(t *testing.T) {
 					}
 
 					// Verify token
-					if err = method.Verify(strings.Join(parts[0:2], "."), parts[2], key); err != nil {
+					if err = method.Verify(strings.Join(parts[0:2], "."), token.Signature, key); err != nil {
 						t.Errorf("could not verify token: %v", err)
 						t.Error(tokenStr)
 						return
@@ -191,6 +204,22 @@ func TestSigningMethodKMS_Override(t *testing.T) {
 			"ES384",
 			SigningMethodKMSES384,
 		},
+		{
+			"RS512",
+			SigningMethodKMSRS512,
+		},
+		{
+			"PS512",
+			SigningMethodKMSPS512,
+		},
+		{
+			"ES256K",
+			SigningMethodKMSES256K,
+		},
+		{
+			"EdDSA",
+			SigningMethodKMSEdDSA,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -280,6 +309,32 @@ func TestSigningMethodKMS_Hash(t *testing.T) {
 	}
 }
 
+func Test_kmsSigningMethodForAlgorithm(t *testing.T) {
+	tests := []struct {
+		algorithm kmspb.CryptoKeyVersion_CryptoKeyVersionAlgorithm
+		want      *SigningMethodKMS
+	}{
+		{kmspb.CryptoKeyVersion_RSA_SIGN_PKCS1_2048_SHA256, SigningMethodKMSRS256},
+		{kmspb.CryptoKeyVersion_RSA_SIGN_PKCS1_4096_SHA256, SigningMethodKMSRS256},
+		{kmspb.CryptoKeyVersion_RSA_SIGN_PKCS1_4096_SHA512, SigningMethodKMSRS512},
+		{kmspb.CryptoKeyVersion_RSA_SIGN_PSS_3072_SHA256, SigningMethodKMSPS256},
+		{kmspb.CryptoKeyVersion_RSA_SIGN_PSS_4096_SHA512, SigningMethodKMSPS512},
+		{kmspb.CryptoKeyVersion_EC_SIGN_P256_SHA256, SigningMethodKMSES256},
+		{kmspb.CryptoKeyVersion_EC_SIGN_P384_SHA384, SigningMethodKMSES384},
+		{kmspb.CryptoKeyVersion_EC_SIGN_SECP256K1_SHA256, SigningMethodKMSES256K},
+		{kmspb.CryptoKeyVersion_EC_SIGN_ED25519, SigningMethodKMSEdDSA},
+		{kmspb.CryptoKeyVersion_HMAC_SHA256, nil},
+		{kmspb.CryptoKeyVersion_GOOGLE_SYMMETRIC_ENCRYPTION, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.algorithm.String(), func(t *testing.T) {
+			if got := kmsSigningMethodForAlgorithm(tt.algorithm); got != tt.want {
+				t.Errorf("kmsSigningMethodForAlgorithm() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestKMSVerfiyKeyfunc(t *testing.T) {
 	ctx, err := newContextFunc()
 	if err != nil {
@@ -0,0 +1,100 @@
+package oauth2
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/oauth2"
+	"google.golang.org/grpc/credentials"
+
+	gcpjwt "github.com/someone1/gcp-jwt-go/v3"
+)
+
+// tokenEarlyExpiry is how long before their expiry cached tokens are replaced
+const tokenEarlyExpiry = time.Minute
+
+// IAMPerRPCCredentials returns gRPC credentials.PerRPCCredentials that use the IAM API to sign a token for each
+// service called, as a Bearer token in the authorization metadata. The audience of each token is the URI of the
+// service called (e.g. https://example.com/package.Service), following Google's self-signed JWT convention, and
+// tokens are reused for the audience until shortly before they expire. Use with grpc.WithPerRPCCredentials.
+//
+// Complimentary to the gRPC interceptors in https://github.com/someone1/gcp-jwt-go/jwtmiddleware
+func IAMPerRPCCredentials(ctx context.Context, config *gcpjwt.IAMConfig) (credentials.PerRPCCredentials, error) {
+	method, err := iamSigningMethod(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return newPerRPCCredentials(gcpjwt.NewIAMContext(ctx, config), method, config.ServiceAccount), nil
+}
+
+// KMSPerRPCCredentials returns gRPC credentials.PerRPCCredentials that use Cloud KMS to sign a token for each service
+// called, with the provided signing method and issuer, see IAMPerRPCCredentials. Use gcpjwt.KMSSigningMethod to choose
+// the signing method from the algorithm of the configured key.
+func KMSPerRPCCredentials(ctx context.Context, config *gcpjwt.KMSConfig, method jwt.SigningMethod, issuer string) credentials.PerRPCCredentials {
+	return newPerRPCCredentials(gcpjwt.NewKMSContext(ctx, config), method, issuer)
+}
+
+type perRPCCredentials struct {
+	newTokenSource func(audience string) oauth2.TokenSource
+
+	mu      sync.Mutex
+	sources map[string]oauth2.TokenSource
+}
+
+func newPerRPCCredentials(ctx context.Context, method jwt.SigningMethod, issuer string) *perRPCCredentials {
+	return &perRPCCredentials{
+		newTokenSource: func(audience string) oauth2.TokenSource {
+			return &jwtAccessTokenSource{
+				ctx:      ctx,
+				method:   method,
+				issuer:   issuer,
+				audience: audience,
+			}
+		},
+		sources: make(map[string]oauth2.TokenSource),
+	}
+}
+
+// GetRequestMetadata implements credentials.PerRPCCredentials, signing a token with the first URI as the audience.
+func (c *perRPCCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	ri, _ := credentials.RequestInfoFromContext(ctx)
+	if err := credentials.CheckSecurityLevel(ri.AuthInfo, credentials.PrivacyAndIntegrity); err != nil {
+		return nil, fmt.Errorf("gcpjwt/oauth2: unable to transfer PerRPCCredentials: %v", err)
+	}
+	if len(uri) == 0 || uri[0] == "" {
+		return nil, fmt.Errorf("gcpjwt/oauth2: missing URI to use as the token audience")
+	}
+
+	token, err := c.tokenSource(uri[0]).Token()
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]string{
+		"authorization": token.Type() + " " + token.AccessToken,
+	}, nil
+}
+
+// RequireTransportSecurity implements credentials.PerRPCCredentials, Bearer tokens are only sent over secure
+// connections.
+func (c *perRPCCredentials) RequireTransportSecurity() bool {
+	return true
+}
+
+// tokenSource will return the token source caching tokens for the audience
+func (c *perRPCCredentials) tokenSource(audience string) oauth2.TokenSource {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ts, ok := c.sources[audience]
+	if !ok {
+		ts = oauth2.ReuseTokenSourceWithExpiry(nil, c.newTokenSource(audience), tokenEarlyExpiry)
+		c.sources[audience] = ts
+	}
+
+	return ts
+}
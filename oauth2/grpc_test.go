@@ -0,0 +1,89 @@
+package oauth2
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/credentials/local"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+)
+
+type countingTokenSource struct {
+	audience string
+	calls    *int
+}
+
+func (ts *countingTokenSource) Token() (*oauth2.Token, error) {
+	*ts.calls++
+	return &oauth2.Token{AccessToken: ts.audience, TokenType: "Bearer", Expiry: time.Now().Add(time.Hour)}, nil
+}
+
+func TestPerRPCCredentials(t *testing.T) {
+	var mu sync.Mutex
+	var authorizations []string
+	listener, err := net.Listen("unix", filepath.Join(t.TempDir(), "grpc.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer(grpc.Creds(local.NewCredentials()), grpc.UnaryInterceptor(
+		func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			md, _ := metadata.FromIncomingContext(ctx)
+			mu.Lock()
+			authorizations = append(authorizations, md.Get("authorization")...)
+			mu.Unlock()
+			return handler(ctx, req)
+		}))
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	go func() { _ = server.Serve(listener) }()
+	defer server.Stop()
+
+	calls := 0
+	creds := &perRPCCredentials{
+		newTokenSource: func(audience string) oauth2.TokenSource {
+			return &countingTokenSource{audience: audience, calls: &calls}
+		},
+		sources: make(map[string]oauth2.TokenSource),
+	}
+	if !creds.RequireTransportSecurity() {
+		t.Errorf("RequireTransportSecurity() = false, want true")
+	}
+
+	conn, err := grpc.NewClient("unix://"+listener.Addr().String(), grpc.WithTransportCredentials(local.NewCredentials()), grpc.WithPerRPCCredentials(creds))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	client := healthpb.NewHealthClient(conn)
+	for i := 0; i < 2; i++ {
+		if _, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{}); err != nil {
+			t.Errorf("Check() error = %v", err)
+			return
+		}
+	}
+
+	if calls != 1 {
+		t.Errorf("expected the token to be reused for the audience, got %d tokens", calls)
+	}
+	if len(authorizations) != 2 || !strings.HasPrefix(authorizations[0], "Bearer https://") || !strings.HasSuffix(authorizations[0], "/grpc.health.v1.Health") {
+		t.Errorf("unexpected authorization metadata %v, want Bearer tokens for the service URI", authorizations)
+	}
+
+	// Tokens are never sent over insecure connections
+	if _, err := grpc.NewClient("localhost:0", grpc.WithTransportCredentials(insecure.NewCredentials()), grpc.WithPerRPCCredentials(creds)); err == nil {
+		t.Errorf("expected an error using the credentials over an insecure connection")
+	}
+	if _, err := creds.GetRequestMetadata(context.Background(), "https://example.com/package.Service"); err == nil {
+		t.Errorf("expected an error getting request metadata without a secure connection")
+	}
+}
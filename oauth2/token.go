@@ -5,13 +5,13 @@ package oauth2
 import (
 	"context"
 	"fmt"
-	"strings"
 	"time"
 
-	"github.com/dgrijalva/jwt-go"
+	"github.com/golang-jwt/jwt/v5"
 	"golang.org/x/oauth2"
+	"google.golang.org/appengine"
 
-	gcpjwt "github.com/someone1/gcp-jwt-go/v2"
+	gcpjwt "github.com/someone1/gcp-jwt-go/v3"
 )
 
 // JWTAccessTokenSource returns a TokenSource that uses the IAM API to sign tokens.
@@ -23,62 +23,91 @@ import (
 //
 // Complimentary to https://github.com/someone1/gcp-jwt-go/jwtmiddleware
 func JWTAccessTokenSource(ctx context.Context, config *gcpjwt.IAMConfig, audience string) (oauth2.TokenSource, error) {
-	ctx = gcpjwt.NewIAMContext(ctx, config)
-	ts := &jwtAccessTokenSource{
-		ctx:       ctx,
-		audience:  audience,
-		jwtConfig: config,
+	method, err := iamSigningMethod(config)
+	if err != nil {
+		return nil, err
 	}
-	tok, err := ts.Token()
+
+	return newTokenSource(gcpjwt.NewIAMContext(ctx, config), method, config.ServiceAccount, audience)
+}
+
+// KMSTokenSource returns a TokenSource that uses Cloud KMS to sign tokens, see JWTAccessTokenSource. The signing method
+// is chosen from the algorithm of the configured key, see gcpjwt.KMSSigningMethod, and the provided issuer is used as
+// the iss and sub claims of the tokens.
+func KMSTokenSource(ctx context.Context, config *gcpjwt.KMSConfig, issuer, audience string) (oauth2.TokenSource, error) {
+	method, err := gcpjwt.KMSSigningMethod(ctx, config)
 	if err != nil {
 		return nil, err
 	}
-	return oauth2.ReuseTokenSource(tok, ts), nil
+
+	return newTokenSource(gcpjwt.NewKMSContext(ctx, config), method, issuer, audience)
 }
 
-type jwtAccessTokenSource struct {
-	ctx       context.Context
-	audience  string
-	jwtConfig *gcpjwt.IAMConfig
+// AppEngineTokenSource returns a TokenSource that uses the AppEngine app identity service to sign tokens, see
+// JWTAccessTokenSource. The app's service account is used as the iss and sub claims of the tokens. This is only
+// available on AppEngine standard, the provided context must be an AppEngine context.
+func AppEngineTokenSource(ctx context.Context, audience string) (oauth2.TokenSource, error) {
+	serviceAccount, err := appengine.ServiceAccount(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("gcpjwt/oauth2: could not get the AppEngine service account: %v", err)
+	}
+
+	return newTokenSource(ctx, gcpjwt.SigningMethodAppEngine, serviceAccount, audience)
 }
 
-func (ts *jwtAccessTokenSource) Token() (*oauth2.Token, error) {
-	iat := time.Now()
-	exp := iat.Add(time.Hour)
-	claims := &jwt.StandardClaims{
-		Issuer:    ts.jwtConfig.ServiceAccount,
-		Subject:   ts.jwtConfig.ServiceAccount,
-		IssuedAt:  iat.Unix(),
-		NotBefore: iat.Unix(),
-		ExpiresAt: exp.Unix(),
-		Audience:  ts.audience,
+// newTokenSource will return a TokenSource reusing tokens signed with the signing method until they expire, the
+// first token is signed before returning.
+func newTokenSource(ctx context.Context, method jwt.SigningMethod, issuer, audience string) (oauth2.TokenSource, error) {
+	ts := &jwtAccessTokenSource{
+		ctx:      ctx,
+		method:   method,
+		issuer:   issuer,
+		audience: audience,
 	}
+	tok, err := ts.Token()
+	if err != nil {
+		return nil, err
+	}
+	return oauth2.ReuseTokenSource(tok, ts), nil
+}
 
-	var token *jwt.Token
-	switch ts.jwtConfig.IAMType {
+// iamSigningMethod will return the signing method for the config's IAMType
+func iamSigningMethod(config *gcpjwt.IAMConfig) (jwt.SigningMethod, error) {
+	switch config.IAMType {
 	case gcpjwt.IAMBlobType:
-		token = jwt.New(gcpjwt.SigningMethodIAMBlob)
+		return gcpjwt.SigningMethodIAMBlob, nil
 	case gcpjwt.IAMJwtType:
-		token = jwt.New(gcpjwt.SigningMethodIAMJWT)
+		return gcpjwt.SigningMethodIAMJWT, nil
 	default:
-		return nil, fmt.Errorf("gcpjwt/oauth2: unknown token type `%v` provided", ts.jwtConfig.IAMType)
+		return nil, fmt.Errorf("gcpjwt/oauth2: unknown token type `%v` provided", config.IAMType)
 	}
+}
 
-	token.Claims = claims
+// jwtAccessTokenSource signs tokens for the audience with the signing method, the ctx must carry the configuration
+// the signing method expects.
+type jwtAccessTokenSource struct {
+	ctx      context.Context
+	method   jwt.SigningMethod
+	issuer   string
+	audience string
+}
 
-	signingString, err := token.SigningString()
-	if err != nil {
-		return nil, err
+func (ts *jwtAccessTokenSource) Token() (*oauth2.Token, error) {
+	iat := time.Now()
+	exp := iat.Add(time.Hour)
+	claims := &jwt.RegisteredClaims{
+		Issuer:    ts.issuer,
+		Subject:   ts.issuer,
+		IssuedAt:  jwt.NewNumericDate(iat),
+		NotBefore: jwt.NewNumericDate(iat),
+		ExpiresAt: jwt.NewNumericDate(exp),
+		Audience:  jwt.ClaimStrings{ts.audience},
 	}
 
-	at, err := token.Method.Sign(signingString, ts.ctx)
+	at, err := gcpjwt.SignToken(ts.ctx, ts.method, claims)
 	if err != nil {
 		return nil, fmt.Errorf("gcpjwt/oauth2: could not sign JWT: %v", err)
 	}
 
-	if ts.jwtConfig.IAMType == gcpjwt.IAMBlobType {
-		at = strings.Join([]string{signingString, at}, ".")
-	}
-
 	return &oauth2.Token{AccessToken: at, TokenType: "Bearer", Expiry: exp}, nil
 }
@@ -0,0 +1,134 @@
+package oauth2
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"hash/crc32"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	kms "cloud.google.com/go/kms/apiv1"
+	kmspb "cloud.google.com/go/kms/apiv1/kmspb"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	gcpjwt "github.com/someone1/gcp-jwt-go/v3"
+	"github.com/someone1/gcp-jwt-go/v3/jwtmiddleware"
+)
+
+// fakeKMS implements the GetPublicKey and AsymmetricSign Cloud KMS APIs for a single EC_SIGN_P256_SHA256 key
+type fakeKMS struct {
+	kmspb.UnimplementedKeyManagementServiceServer
+	key *ecdsa.PrivateKey
+}
+
+func checksum(data []byte) *wrapperspb.Int64Value {
+	return wrapperspb.Int64(int64(crc32.Checksum(data, crc32.MakeTable(crc32.Castagnoli))))
+}
+
+func (f *fakeKMS) GetPublicKey(_ context.Context, req *kmspb.GetPublicKeyRequest) (*kmspb.PublicKey, error) {
+	der, err := x509.MarshalPKIXPublicKey(&f.key.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	key := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	return &kmspb.PublicKey{
+		Name:      req.Name,
+		Pem:       string(key),
+		PemCrc32C: checksum(key),
+		Algorithm: kmspb.CryptoKeyVersion_EC_SIGN_P256_SHA256,
+	}, nil
+}
+
+func (f *fakeKMS) AsymmetricSign(_ context.Context, req *kmspb.AsymmetricSignRequest) (*kmspb.AsymmetricSignResponse, error) {
+	signature, err := ecdsa.SignASN1(rand.Reader, f.key, req.GetDigest().GetSha256())
+	if err != nil {
+		return nil, err
+	}
+	return &kmspb.AsymmetricSignResponse{
+		Name:                 req.Name,
+		Signature:            signature,
+		SignatureCrc32C:      checksum(signature),
+		VerifiedDigestCrc32C: true,
+	}, nil
+}
+
+func TestKMSTokenSource(t *testing.T) {
+	ctx := context.Background()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listener := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer()
+	kmspb.RegisterKeyManagementServiceServer(server, &fakeKMS{key: key})
+	go func() { _ = server.Serve(listener) }()
+	defer server.Stop()
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client, err := kms.NewKeyManagementClient(ctx, option.WithGRPCConn(conn))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const (
+		issuer   = "issuer"
+		audience = "https://example.com"
+	)
+	config := &gcpjwt.KMSConfig{
+		KeyPath:   "projects/p/locations/global/keyRings/r/cryptoKeys/k/cryptoKeyVersions/1",
+		KMSClient: client,
+	}
+
+	method, err := gcpjwt.KMSSigningMethod(ctx, config)
+	if err != nil || method != gcpjwt.SigningMethodKMSES256 {
+		t.Errorf("KMSSigningMethod() = %v, %v, want %v", method, err, gcpjwt.SigningMethodKMSES256)
+		return
+	}
+
+	source, err := KMSTokenSource(ctx, config, issuer, audience)
+	if err != nil {
+		t.Errorf("KMSTokenSource() error = %v", err)
+		return
+	}
+	token, err := source.Token()
+	if err != nil {
+		t.Errorf("Token() error = %v", err)
+		return
+	}
+
+	// The token must be accepted by the middleware
+	keyFunc, err := gcpjwt.KMSVerfiyKeyfunc(ctx, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := jwtmiddleware.New(ctx, nil,
+		jwtmiddleware.WithAudience(audience),
+		jwtmiddleware.WithIssuers(issuer),
+		jwtmiddleware.WithKeyfunc(keyFunc),
+	)(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {}))
+
+	r := httptest.NewRequest(http.MethodGet, audience, nil)
+	token.SetAuthHeader(r)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("middleware rejected the token with %v", w.Code)
+	}
+}
@@ -0,0 +1,174 @@
+package gcpjwt
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"time"
+
+	"google.golang.org/api/googleapi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// DefaultRetryMaxAttempts is the default maximum number of attempts, including the first, made for calls to the
+	// IAM Credentials and Cloud KMS APIs and to retrieve public keys.
+	DefaultRetryMaxAttempts = 3
+
+	// DefaultRetryInitialBackoff is the default maximum time to wait before the first retry.
+	DefaultRetryInitialBackoff = 100 * time.Millisecond
+
+	// DefaultRetryMaxBackoff is the default upper bound for the time to wait between retries.
+	DefaultRetryMaxBackoff = 5 * time.Second
+
+	// DefaultRetryMultiplier is the default factor the backoff is increased by after each retry.
+	DefaultRetryMultiplier = 2
+)
+
+// RetryPolicy configures how remote signing calls (signBlob, signJwt, Cloud KMS AsymmetricSign, MacSign and MacVerify)
+// and public key retrieval are retried after transient failures. Retries wait for a random duration up to the current
+// backoff (full jitter), which grows exponentially with each retry. Retries stop early if the context is done or its
+// deadline would pass before the next attempt. A nil *RetryPolicy uses the defaults, zero values fall back to the
+// defaults as well. Use a MaxAttempts of 1 to disable retries.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts, including the first. Defaults to DefaultRetryMaxAttempts.
+	MaxAttempts int
+
+	// InitialBackoff is the maximum time to wait before the first retry. Defaults to DefaultRetryInitialBackoff.
+	InitialBackoff time.Duration
+
+	// MaxBackoff is the upper bound for the time to wait between retries. Defaults to DefaultRetryMaxBackoff.
+	MaxBackoff time.Duration
+
+	// Multiplier is the factor the backoff is increased by after each retry. Defaults to DefaultRetryMultiplier, which
+	// is also used for values below 1 or that are not finite.
+	Multiplier float64
+
+	// Retryable reports whether a call that failed with the error should be retried. Defaults to IsRetryableError.
+	Retryable func(err error) bool
+}
+
+func (p *RetryPolicy) maxAttempts() int {
+	if p == nil || p.MaxAttempts <= 0 {
+		return DefaultRetryMaxAttempts
+	}
+	return p.MaxAttempts
+}
+
+func (p *RetryPolicy) initialBackoff() time.Duration {
+	if p == nil || p.InitialBackoff <= 0 {
+		return DefaultRetryInitialBackoff
+	}
+	return p.InitialBackoff
+}
+
+func (p *RetryPolicy) maxBackoff() time.Duration {
+	if p == nil || p.MaxBackoff <= 0 {
+		return DefaultRetryMaxBackoff
+	}
+	return p.MaxBackoff
+}
+
+func (p *RetryPolicy) multiplier() float64 {
+	if p == nil || !(p.Multiplier >= 1) || math.IsInf(p.Multiplier, 1) {
+		return DefaultRetryMultiplier
+	}
+	return p.Multiplier
+}
+
+func (p *RetryPolicy) retryable(err error) bool {
+	if p == nil || p.Retryable == nil {
+		return IsRetryableError(err)
+	}
+	return p.Retryable(err)
+}
+
+// do will call fn until it succeeds, returns an error that should not be retried, or the policy is exhausted. The
+// error of a call that was not retried is returned as is, otherwise a *RetryError with the error of every attempt.
+func (p *RetryPolicy) do(ctx context.Context, fn func() error) error {
+	var attempts []error
+	backoff := p.initialBackoff()
+	for {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		attempts = append(attempts, err)
+		if len(attempts) >= p.maxAttempts() || !p.retryable(err) {
+			break
+		}
+
+		wait := jitter(backoff)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			break
+		}
+		if !sleep(ctx, wait) {
+			break
+		}
+
+		// Grow the backoff in float64 so a large multiplier cannot overflow the duration
+		if next, limit := float64(backoff)*p.multiplier(), p.maxBackoff(); next < float64(limit) {
+			backoff = time.Duration(next)
+		} else {
+			backoff = limit
+		}
+	}
+
+	if len(attempts) == 1 {
+		return attempts[0]
+	}
+	return &RetryError{Attempts: attempts}
+}
+
+// jitter will return the time to wait before a retry, a random duration up to the backoff. It is a variable so tests
+// can make the wait predictable.
+var jitter = func(backoff time.Duration) time.Duration {
+	return time.Duration(rand.Int63n(int64(backoff))) + 1
+}
+
+// sleep will wait for the duration, returning false if the context is done first
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// IsRetryableError is the default RetryPolicy classifier. It reports whether the error is transient: an HTTP 429 or
+// 5xx response from a Google API or key source, a gRPC UNAVAILABLE or RESOURCE_EXHAUSTED status, a network timeout,
+// or an *IntegrityError. Errors caused by the context being canceled or its deadline passing are never retryable.
+func IsRetryableError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var integrityErr *IntegrityError
+	if errors.As(err, &integrityErr) {
+		return true
+	}
+
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		return apiErr.Code == http.StatusTooManyRequests || apiErr.Code >= http.StatusInternalServerError
+	}
+
+	if s, ok := status.FromError(err); ok {
+		switch s.Code() {
+		case codes.Unavailable, codes.ResourceExhausted:
+			return true
+		}
+		return false
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
@@ -0,0 +1,226 @@
+package gcpjwt
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"google.golang.org/api/googleapi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestIsRetryableError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"Nil", nil, false},
+		{"Other", errors.New("other"), false},
+		{"TooManyRequests", &googleapi.Error{Code: http.StatusTooManyRequests}, true},
+		{"ServiceUnavailable", &googleapi.Error{Code: http.StatusServiceUnavailable}, true},
+		{"Forbidden", &googleapi.Error{Code: http.StatusForbidden}, false},
+		{"WrappedGoogleAPI", fmt.Errorf("wrapped: %w", &googleapi.Error{Code: http.StatusBadGateway}), true},
+		{"Unavailable", status.Error(codes.Unavailable, "unavailable"), true},
+		{"ResourceExhausted", status.Error(codes.ResourceExhausted, "quota"), true},
+		{"PermissionDenied", status.Error(codes.PermissionDenied, "denied"), false},
+		{"Integrity", &IntegrityError{Name: "key", Check: "signature_crc32c"}, true},
+		{"Canceled", context.Canceled, false},
+		{"DeadlineExceeded", fmt.Errorf("wrapped: %w", context.DeadlineExceeded), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsRetryableError(tt.err); got != tt.want {
+				t.Errorf("IsRetryableError() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryPolicy_do(t *testing.T) {
+	transient := &googleapi.Error{Code: http.StatusServiceUnavailable}
+	permanent := &googleapi.Error{Code: http.StatusForbidden}
+	policy := &RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}
+
+	tests := []struct {
+		name         string
+		policy       *RetryPolicy
+		errs         []error
+		wantCalls    int
+		wantErr      error
+		wantAttempts int
+	}{
+		{"Success", policy, nil, 1, nil, 0},
+		{"SuccessAfterRetries", policy, []error{transient, transient}, 3, nil, 0},
+		{"NotRetryable", policy, []error{permanent}, 1, permanent, 0},
+		{"NotRetryableAfterRetry", policy, []error{transient, permanent}, 2, permanent, 2},
+		{"Exhausted", policy, []error{transient, transient, transient, transient}, 3, transient, 3},
+		{"Disabled", &RetryPolicy{MaxAttempts: 1}, []error{transient}, 1, transient, 0},
+		{"CustomClassifier", &RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond, Retryable: func(err error) bool { return err == permanent }}, []error{permanent}, 2, nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			err := tt.policy.do(context.Background(), func() error {
+				calls++
+				if calls <= len(tt.errs) {
+					return tt.errs[calls-1]
+				}
+				return nil
+			})
+			if calls != tt.wantCalls {
+				t.Errorf("RetryPolicy.do() calls = %v, want %v", calls, tt.wantCalls)
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("RetryPolicy.do() error = %v, want %v", err, tt.wantErr)
+			}
+
+			var retryErr *RetryError
+			if errors.As(err, &retryErr) != (tt.wantAttempts > 0) {
+				t.Errorf("RetryPolicy.do() error = %T, want *RetryError %v", err, tt.wantAttempts > 0)
+				return
+			}
+			if retryErr != nil && (len(retryErr.Attempts) != tt.wantAttempts || retryErr.Last() != tt.wantErr) {
+				t.Errorf("RetryPolicy.do() attempts = %v, want %v ending with %v", retryErr.Attempts, tt.wantAttempts, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRetryPolicy_doContext(t *testing.T) {
+	transient := status.Error(codes.Unavailable, "unavailable")
+	policy := &RetryPolicy{MaxAttempts: 10, InitialBackoff: time.Hour}
+
+	// Always wait for the full backoff so the waits are predictable
+	defer func(j func(time.Duration) time.Duration) { jitter = j }(jitter)
+	jitter = func(backoff time.Duration) time.Duration { return backoff }
+
+	// The deadline would pass before the next attempt
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	calls := 0
+	err := policy.do(ctx, func() error {
+		calls++
+		return transient
+	})
+	if calls != 1 || err != transient {
+		t.Errorf("RetryPolicy.do() calls = %v error = %v, want 1 call and %v", calls, err, transient)
+	}
+
+	// The context is canceled while waiting to retry
+	ctx, cancel = context.WithCancel(context.Background())
+	calls = 0
+	err = (&RetryPolicy{MaxAttempts: 10, InitialBackoff: 50 * time.Millisecond}).do(ctx, func() error {
+		calls++
+		if calls == 2 {
+			cancel()
+		}
+		return transient
+	})
+	var retryErr *RetryError
+	if calls != 2 || !errors.As(err, &retryErr) || len(retryErr.Attempts) != 2 {
+		t.Errorf("RetryPolicy.do() calls = %v error = %v, want 2 calls and *RetryError", calls, err)
+	}
+}
+
+func TestRetryPolicy_doBackoff(t *testing.T) {
+	transient := status.Error(codes.Unavailable, "unavailable")
+	tests := []struct {
+		name       string
+		multiplier float64
+	}{
+		{"Large", 1e300},
+		{"Infinite", math.Inf(1)},
+		{"NaN", math.NaN()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var waits []time.Duration
+			defer func(j func(time.Duration) time.Duration) { jitter = j }(jitter)
+			jitter = func(backoff time.Duration) time.Duration {
+				waits = append(waits, backoff)
+				return time.Nanosecond
+			}
+
+			policy := &RetryPolicy{MaxAttempts: 5, InitialBackoff: time.Millisecond, MaxBackoff: time.Second, Multiplier: tt.multiplier}
+			_ = policy.do(context.Background(), func() error { return transient })
+			for _, wait := range waits {
+				if wait <= 0 || wait > time.Second {
+					t.Errorf("RetryPolicy.do() backoffs = %v, want within (0, %v]", waits, time.Second)
+					return
+				}
+			}
+		})
+	}
+}
+
+func Test_fetchCertificatesRetry(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwks := testJWKS(t, rsaKey, ecKey)
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write(jwks)
+	}))
+	defer server.Close()
+
+	config := &IAMConfig{
+		KeySource:    JWKSKeySource,
+		KeySourceURL: server.URL,
+		RetryPolicy:  &RetryPolicy{InitialBackoff: time.Millisecond},
+	}
+	certs, _, err := fetchCertificates(context.Background(), config)
+	if err != nil {
+		t.Errorf("fetchCertificates() error = %v", err)
+		return
+	}
+	if requests != 2 || len(certs) != 2 {
+		t.Errorf("fetchCertificates() requests = %v certificates = %v, want 2 and 2", requests, len(certs))
+	}
+}
+
+func Test_fetchCertificatesContext(t *testing.T) {
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-done:
+		}
+	}))
+	defer server.Close()
+	defer close(done)
+
+	config := &IAMConfig{
+		KeySource:    JWKSKeySource,
+		KeySourceURL: server.URL,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	// The request must be abandoned once the context is done
+	if _, _, err := fetchCertificates(ctx, config); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("fetchCertificates() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
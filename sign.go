@@ -0,0 +1,83 @@
+package gcpjwt
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// SignToken will create a token for the claims signed with the provided signing method, setting the kid and typ
+// headers before the token is signed so it can always be verified by its kid. The ctx must carry the configuration the
+// signing method expects, as it would be passed as the key to jwt.Token.SignedString:
+//   - a KMSConfig (see NewKMSContext) for the Cloud KMS signing methods, the kid is KMSConfig.CurrentKeyID
+//   - an IAMConfig (see NewIAMContext) for the IAM signing methods, the kid is the service account key used to sign
+//   - an AppEngine context for SigningMethodAppEngine, the kid is the name of the key used to sign
+//
+// The signBlob and AppEngine APIs do not allow picking the key to sign with, so the key used for the previous token is
+// assumed and the token is signed again if the API used a different key. The signJwt API sets its own header.
+func SignToken(ctx context.Context, method jwt.SigningMethod, claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(method, claims)
+
+	switch m := method.(type) {
+	case *SigningMethodKMS, *SigningMethodKMSHMAC:
+		config, ok := KMSFromContext(ctx)
+		if !ok {
+			return "", ErrMissingConfig
+		}
+		kid, err := config.CurrentKeyID(ctx)
+		if err != nil {
+			return "", err
+		}
+		token.Header["kid"] = kid
+		return token.SignedString(ctx)
+	case *SigningMethodAppEngineImpl:
+		return signWithKeyID(token, m.KeyID(), func(signingString string) ([]byte, string, error) {
+			return m.signBytes(ctx, signingString)
+		})
+	case *SigningMethodIAM:
+		if m == SigningMethodIAMJWT {
+			signedJwt, _, err := SignJwt(ctx, claims)
+			return signedJwt, err
+		}
+		config, ok := IAMFromContext(ctx)
+		if !ok {
+			return "", ErrMissingConfig
+		}
+		iamService, err := getIAMService(ctx, config)
+		if err != nil {
+			return "", err
+		}
+		return signWithKeyID(token, config.KeyID(), func(signingString string) ([]byte, string, error) {
+			return m.sign(ctx, iamService, config, signingString)
+		})
+	}
+
+	return "", fmt.Errorf("gcpjwt: unsupported signing method: %v", method.Alg())
+}
+
+// signWithKeyID will sign the token with its kid header set to the expected key id. If the key used to sign differs
+// from what was expected, the token is signed once more with the kid header set to the key actually used.
+func signWithKeyID(token *jwt.Token, kid string, sign func(signingString string) ([]byte, string, error)) (string, error) {
+	for attempt := 0; attempt < 2; attempt++ {
+		if kid != "" {
+			token.Header["kid"] = kid
+		}
+
+		signingString, err := token.SigningString()
+		if err != nil {
+			return "", err
+		}
+
+		signature, keyID, err := sign(signingString)
+		if err != nil {
+			return "", err
+		}
+		if keyID == kid {
+			return signingString + "." + token.EncodeSegment(signature), nil
+		}
+		kid = keyID
+	}
+
+	return "", fmt.Errorf("gcpjwt: signing key changed while signing, could not set the kid header")
+}
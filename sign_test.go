@@ -0,0 +1,169 @@
+package gcpjwt
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestSignTokenAndVerify(t *testing.T) {
+	parts := strings.Split(jwtConfig.Email, "@")
+	config := &IAMConfig{
+		ServiceAccount: fmt.Sprintf("api-signer@%s", parts[1]),
+	}
+	ctx, err := newContextFunc()
+	if err != nil {
+		t.Errorf("could not get context: %v", err)
+		return
+	}
+
+	c := NewIAMContext(ctx, config)
+	for _, method := range []*SigningMethodIAM{SigningMethodIAMBlob, SigningMethodIAMJWT} {
+		t.Run(method.Alg(), func(t *testing.T) {
+			tokenString, err := SignToken(c, method, jwt.MapClaims{"foo": "bar"})
+			if err != nil {
+				t.Errorf("Error signing token: %v", err)
+				return
+			}
+
+			token, _, err := jwt.NewParser().ParseUnverified(tokenString, jwt.MapClaims{})
+			if err != nil {
+				t.Errorf("Error parsing token: %v", err)
+				return
+			}
+			if kid, _ := token.Header["kid"].(string); kid == "" {
+				t.Errorf("Expected kid header to be set")
+			}
+			if typ, _ := token.Header["typ"].(string); typ != "JWT" {
+				t.Errorf("Expected typ header to be JWT, got %v", token.Header["typ"])
+			}
+
+			if _, err = jwt.NewParser(jwt.WithValidMethods([]string{"RS256"})).Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+				token.Method = method
+				return IAMVerfiyKeyfunc(c, config)(token)
+			}); err != nil {
+				t.Errorf("Error verifying token: %v", err)
+			}
+		})
+	}
+}
+
+func TestSignToken(t *testing.T) {
+	tests := []struct {
+		name       string
+		ctx        context.Context
+		method     jwt.SigningMethod
+		compareErr error
+	}{
+		{
+			"UnsupportedMethod",
+			context.Background(),
+			jwt.SigningMethodRS256,
+			nil,
+		},
+		{
+			"MissingKMSConfig",
+			context.Background(),
+			SigningMethodKMSES256,
+			ErrMissingConfig,
+		},
+		{
+			"MissingKMSHMACConfig",
+			context.Background(),
+			SigningMethodKMSHS256,
+			ErrMissingConfig,
+		},
+		{
+			"MissingIAMConfig",
+			context.Background(),
+			SigningMethodIAMBlob,
+			ErrMissingConfig,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := SignToken(tt.ctx, tt.method, jwt.MapClaims{})
+			if err == nil || (tt.compareErr != nil && err != tt.compareErr) {
+				t.Errorf("SignToken() error = %v, compareErr %v", err, tt.compareErr)
+			}
+		})
+	}
+}
+
+func Test_signWithKeyID(t *testing.T) {
+	tests := []struct {
+		name      string
+		guess     string
+		keyIDs    []string
+		wantKid   string
+		wantCalls int
+		wantErr   bool
+	}{
+		{
+			"CorrectGuess",
+			"key1",
+			[]string{"key1"},
+			"key1",
+			1,
+			false,
+		},
+		{
+			"NoGuess",
+			"",
+			[]string{"key1", "key1"},
+			"key1",
+			2,
+			false,
+		},
+		{
+			"RotatedKey",
+			"key1",
+			[]string{"key2", "key2"},
+			"key2",
+			2,
+			false,
+		},
+		{
+			"KeyKeepsChanging",
+			"key1",
+			[]string{"key2", "key3"},
+			"",
+			2,
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			token := jwt.NewWithClaims(SigningMethodIAMBlob, jwt.MapClaims{"foo": "bar"})
+			tokenString, err := signWithKeyID(token, tt.guess, func(signingString string) ([]byte, string, error) {
+				keyID := tt.keyIDs[calls]
+				calls++
+				// Sign with the key id so the test can check the signature matches the header
+				return []byte(keyID), keyID, nil
+			})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("signWithKeyID() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("signWithKeyID() called sign %d times, want %d", calls, tt.wantCalls)
+			}
+			if err != nil {
+				return
+			}
+
+			parsed, parts, err := jwt.NewParser().ParseUnverified(tokenString, jwt.MapClaims{})
+			if err != nil {
+				t.Errorf("could not parse token: %v", err)
+				return
+			}
+			if parsed.Header["kid"] != tt.wantKid || string(parsed.Signature) != tt.wantKid || len(parts) != 3 {
+				t.Errorf("signWithKeyID() kid = %v, signature = %s, want %v", parsed.Header["kid"], parsed.Signature, tt.wantKid)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package gcpjwt
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Verifier holds a registry of trusted issuers and the key sources used to verify their tokens. The key source is
+// picked by peeking at the token's unverified iss claim, with tokens from unknown issuers being rejected before any
+// keys are retrieved. The key source is then responsible for picking the key based on the token's kid header.
+type Verifier struct {
+	keyFuncs map[string]jwt.Keyfunc
+
+	sync.RWMutex
+}
+
+// NewVerifier returns a new Verifier without any trusted issuers.
+func NewVerifier() *Verifier {
+	return &Verifier{
+		keyFuncs: make(map[string]jwt.Keyfunc),
+	}
+}
+
+// AddIssuer will trust tokens from the provided issuer, verifying them with the provided jwt.Keyfunc.
+func (v *Verifier) AddIssuer(issuer string, keyFunc jwt.Keyfunc) {
+	v.Lock()
+	defer v.Unlock()
+
+	v.keyFuncs[issuer] = keyFunc
+}
+
+// AddIAM will trust tokens issued by the config's ServiceAccount, verifying them with an IAMVerfiyKeyfunc.
+func (v *Verifier) AddIAM(ctx context.Context, config *IAMConfig) {
+	v.AddIssuer(config.ServiceAccount, IAMVerfiyKeyfunc(ctx, config))
+}
+
+// AddJWKS will trust tokens from the provided issuer, verifying them with the keys published as a JSON Web Key Set at
+// the provided URL. Keys are cached according to the response's Cache-Control header.
+func (v *Verifier) AddJWKS(ctx context.Context, issuer, url string) {
+	v.AddIssuer(issuer, IAMVerfiyKeyfunc(ctx, &IAMConfig{
+		KeySource:    JWKSKeySource,
+		KeySourceURL: url,
+		EnableCache:  true,
+	}))
+}
+
+// AddKMS will trust tokens from the provided issuer, verifying them with a KMSVerfiyKeyfunc.
+func (v *Verifier) AddKMS(ctx context.Context, issuer string, config *KMSConfig) error {
+	keyFunc, err := KMSVerfiyKeyfunc(ctx, config)
+	if err != nil {
+		return err
+	}
+
+	v.AddIssuer(issuer, keyFunc)
+	return nil
+}
+
+// AddAppEngine will trust tokens from the provided issuer, verifying them with an AppEngineVerfiyKeyfunc. This is only
+// available on AppEngine standard.
+func (v *Verifier) AddAppEngine(ctx context.Context, issuer string, enableCache bool, cacheExpiration time.Duration) {
+	v.AddIssuer(issuer, AppEngineVerfiyKeyfunc(ctx, enableCache, cacheExpiration))
+}
+
+// Keyfunc implements jwt.Keyfunc, picking the key source to use based on the token's issuer.
+func (v *Verifier) Keyfunc(token *jwt.Token) (interface{}, error) {
+	issuer, err := token.Claims.GetIssuer()
+	if err != nil {
+		return nil, err
+	}
+	if issuer == "" {
+		return nil, fmt.Errorf("%w: token is missing the iss claim", ErrUnknownIssuer)
+	}
+
+	v.RLock()
+	keyFunc, ok := v.keyFuncs[issuer]
+	v.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w `%s`", ErrUnknownIssuer, issuer)
+	}
+
+	return keyFunc(token)
+}
@@ -0,0 +1,120 @@
+package gcpjwt
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type customClaims struct {
+	jwt.RegisteredClaims
+	Foo string `json:"foo"`
+}
+
+func TestVerifier_Keyfunc(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwks := testJWKS(t, rsaKey, ecKey)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(jwks)
+	}))
+	defer server.Close()
+
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verifier := NewVerifier()
+	verifier.AddJWKS(context.Background(), "https://issuer.example.com", server.URL)
+	verifier.AddIssuer("other", func(token *jwt.Token) (interface{}, error) {
+		return &otherKey.PublicKey, nil
+	})
+
+	tests := []struct {
+		name    string
+		claims  jwt.Claims
+		parseAs jwt.Claims
+		key     interface{}
+		kid     string
+		wantErr bool
+	}{
+		{
+			"JWKSIssuer",
+			jwt.MapClaims{"iss": "https://issuer.example.com"},
+			jwt.MapClaims{},
+			rsaKey,
+			"rsa",
+			false,
+		},
+		{
+			"JWKSIssuerRegisteredClaims",
+			&jwt.RegisteredClaims{Issuer: "https://issuer.example.com"},
+			&jwt.RegisteredClaims{},
+			rsaKey,
+			"rsa",
+			false,
+		},
+		{
+			"CustomClaims",
+			&customClaims{RegisteredClaims: jwt.RegisteredClaims{Issuer: "other"}, Foo: "bar"},
+			&customClaims{},
+			otherKey,
+			"",
+			false,
+		},
+		{
+			"WrongIssuerKey",
+			jwt.MapClaims{"iss": "other"},
+			jwt.MapClaims{},
+			rsaKey,
+			"rsa",
+			true,
+		},
+		{
+			"UnknownIssuer",
+			jwt.MapClaims{"iss": "unknown"},
+			jwt.MapClaims{},
+			rsaKey,
+			"rsa",
+			true,
+		},
+		{
+			"MissingIssuer",
+			jwt.MapClaims{"foo": "bar"},
+			jwt.MapClaims{},
+			rsaKey,
+			"rsa",
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := jwt.NewWithClaims(jwt.SigningMethodRS256, tt.claims)
+			if tt.kid != "" {
+				token.Header["kid"] = tt.kid
+			}
+			tokenString, err := token.SignedString(tt.key)
+			if err != nil {
+				t.Fatalf("could not sign token: %v", err)
+			}
+
+			if _, err = jwt.ParseWithClaims(tokenString, tt.parseAs, verifier.Keyfunc); (err != nil) != tt.wantErr {
+				t.Errorf("jwt.ParseWithClaims() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}